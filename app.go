@@ -1,10 +1,10 @@
 package main
 
 import (
-	"piano-video/videogenerator"
+	"os"
+	"piano-video/cli"
 )
 
 func main() {
-	const midiFilePath = "sample-midis/minuetg.mid"
-	videogenerator.GenerateVideo(midiFilePath)
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
 }
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Exit codes of Run.
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// errUsage marks errors in the command line itself, which exit with
+// ExitUsage rather than ExitError.
+var errUsage = errors.New("usage")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"render", "<in.mid> | --project <file> [-o out.mp4] [options]", "render a MIDI file to a video", runRender},
+		{"preview", "<in.mid> | --project <file> [-t seconds] [-o frame.png] [options]", "draw a single frame of the video as a PNG image", runPreview},
+		{"inspect", "<in.mid> [--json] [--lenient]", "describe the tracks, channels and timing of a MIDI file", runInspect},
+		{"server", "[--addr :8080] [options]", "render videos of uploaded MIDI files over HTTP", runServer},
+		{"themes", "", "list the color themes", runThemes},
+		{"help", "[command]", "show help for a command", runHelp},
+	}
+}
+
+// Run executes the command line args, without the program name, and returns
+// the process exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return ExitUsage
+	}
+	if args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return ExitOK
+	}
+
+	var cmd, found = findCommand(args[0])
+	if !found {
+		fmt.Fprintf(stderr, "piano-video: unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return ExitUsage
+	}
+
+	var err = cmd.run(args[1:], stdout, stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	default:
+		fmt.Fprintf(stderr, "piano-video %s: %v\n", cmd.name, err)
+		return ExitError
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: piano-video <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "piano-video help <command>" for the options of a command.`)
+}
+
+func runHelp(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		printUsage(stdout)
+		return nil
+	}
+	var cmd, found = findCommand(args[0])
+	if !found {
+		fmt.Fprintf(stderr, "piano-video help: unknown command %q\n", args[0])
+		return errUsage
+	}
+	return cmd.run([]string{"-h"}, stdout, stderr)
+}
+
+// newFlagSet returns the flag set of a command, printing its usage line
+// before the flag defaults.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	var cmd, _ = findCommand(name)
+	var fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		var description = strings.ToUpper(cmd.summary[:1]) + cmd.summary[1:]
+		fmt.Fprintf(fs.Output(), "Usage: piano-video %s %s\n\n%s.\n\nOptions:\n", cmd.name, cmd.args, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses flags given before, between and after the positional
+// arguments and checks the number of the latter.
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	var positional = []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		fmt.Fprintf(fs.Output(), "piano-video %s: unexpected number of arguments %d\n\n", fs.Name(), len(positional))
+		fs.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// usageError reports an invalid option value.
+func usageError(fs *flag.FlagSet, err error) error {
+	fmt.Fprintf(fs.Output(), "piano-video %s: %v\n", fs.Name(), err)
+	return errUsage
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"piano-video/midiparser"
+	"sort"
+	"strings"
+)
+
+// maxListed caps the tempo, signature and marker lists of inspect.
+const maxListed = 10
+
+func runInspect(args []string, stdout, stderr io.Writer) error {
+	var fs = newFlagSet("inspect", stderr)
+	var asJSON = fs.Bool("json", false, "print the parsed file as JSON")
+	var lenient = fs.Bool("lenient", false, "repair damaged files instead of failing, listing the repairs")
+	positional, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	midiData, err := midiparser.ParseWithOptions(f, midiparser.Options{Lenient: *lenient})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		var encoder = json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(midiData)
+	}
+	printMidiSummary(stdout, positional[0], midiData)
+	return nil
+}
+
+func printListed[T any](w io.Writer, title string, items []T, format func(T) string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for i, item := range items {
+		if i == maxListed {
+			fmt.Fprintf(w, "  ... and %d more\n", len(items)-maxListed)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", format(item))
+	}
+}
+
+// formatDuration writes seconds as minutes and seconds, e.g. 3:07.5.
+func formatDuration(seconds float64) string {
+	var minutes = int(seconds / 60)
+	return fmt.Sprintf("%d:%04.1f", minutes, seconds-float64(minutes*60))
+}
+
+func printMidiSummary(w io.Writer, path string, midiData midiparser.ParsedMidi) {
+	var meta = midiData.Meta
+	var lastTick = midiData.LastTick()
+
+	fmt.Fprintf(w, "File:      %s\n", path)
+	if title := midiData.Title(); title != "" {
+		fmt.Fprintf(w, "Title:     %s\n", title)
+	}
+	fmt.Fprintf(w, "Tracks:    %d\n", len(midiData.Tracks))
+	if meta.IsSMPTE() {
+		fmt.Fprintf(w, "Timing:    SMPTE %g fps, %d ticks per frame\n", meta.SMPTEFramesPerSecond, meta.TicksPerFrame)
+	} else {
+		fmt.Fprintf(w, "Timing:    %d ticks per quarter note\n", meta.QuarterValue)
+	}
+	var tempoMap = meta.TempoMap()
+	fmt.Fprintf(w, "Length:    %s, %d ticks", formatDuration(tempoMap.Seconds(lastTick)), lastTick)
+	if bars := meta.Bars(lastTick); len(bars) > 0 {
+		fmt.Fprintf(w, ", %d bars", len(bars))
+	}
+	fmt.Fprintln(w)
+
+	printListed(w, "Tempos", meta.Tempos, func(t midiparser.Tempo) string {
+		return fmt.Sprintf("tick %-8d %-8s %.2f bpm", t.OnTick, formatDuration(tempoMap.Seconds(t.OnTick)), t.Bpm)
+	})
+	printListed(w, "Time signatures", meta.TimeSignatures, func(ts midiparser.TimeSignature) string {
+		return fmt.Sprintf("tick %-8d %d/%d", ts.OnTick, ts.Numerator, ts.Denominator)
+	})
+	printListed(w, "Key signatures", meta.KeySignatures, func(ks midiparser.KeySignature) string {
+		return fmt.Sprintf("tick %-8d %s", ks.OnTick, ks.Name())
+	})
+
+	fmt.Fprintf(w, "\nTracks:\n")
+	for i, track := range midiData.Tracks {
+		var channels = [16]bool{}
+		for _, event := range track.Events {
+			channels[event.Channel&0x0F] = true
+		}
+		var channelNumbers = []string{}
+		for channel, used := range channels {
+			if used {
+				channelNumbers = append(channelNumbers, fmt.Sprint(channel+1))
+			}
+		}
+
+		var name = track.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(w, "  %-3d %-28s %5d notes", i, name, len(track.Events))
+		if len(channelNumbers) > 0 {
+			fmt.Fprintf(w, "  channels %s", strings.Join(channelNumbers, ","))
+		}
+		fmt.Fprintln(w)
+	}
+
+	var channels = []byte{}
+	for channel := range midiData.Channels {
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(a, b int) bool { return channels[a] < channels[b] })
+	if len(channels) > 0 {
+		fmt.Fprintf(w, "\nChannels:\n")
+	}
+	for _, channel := range channels {
+		var instrument = midiData.ProgramAt(channel, 0).Instrument
+		if changes := midiData.ProgramChanges[channel]; len(changes) > 0 {
+			instrument = changes[0].Instrument
+		}
+		if midiparser.IsPercussionChannel(channel) {
+			instrument = midiparser.PercussionFamily
+		}
+		fmt.Fprintf(w, "  %-3d %s", int(channel)+1, instrument)
+		if changes := len(midiData.ProgramChanges[channel]); changes > 1 {
+			fmt.Fprintf(w, " (%d program changes)", changes)
+		}
+		fmt.Fprintln(w)
+	}
+
+	printListed(w, "Markers", append(midiData.Markers(), midiData.CuePoints()...), func(t midiparser.TextEvent) string {
+		return fmt.Sprintf("tick %-8d %s", t.OnTick, t.Text)
+	})
+	if lyrics := midiData.Lyrics(); len(lyrics) > 0 {
+		fmt.Fprintf(w, "\nLyrics:    %d syllables\n", len(lyrics))
+	}
+	printListed(w, "Warnings", midiData.Warnings, func(warning *midiparser.ParseError) string {
+		return warning.Error()
+	})
+}
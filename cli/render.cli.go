@@ -0,0 +1,359 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"piano-video/project"
+	"piano-video/videogenerator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// renderFlags are the options shared by render and preview.
+type renderFlags struct {
+	project   string
+	audio     string
+	synth     string
+	soundFont string
+
+	resolution string
+	fps        int
+	keyboard   string
+	theme      string
+	colorBy    string
+	leadIn     float64
+	workers    int
+
+	pedals       bool
+	sustainTails bool
+	lyrics       bool
+	drumStrip    bool
+	drumKeys     bool
+	chapters     bool
+	subtitles    bool
+
+	tracks        string
+	channels      string
+	audioTracks   string
+	audioChannels string
+}
+
+func addRenderFlags(fs *flag.FlagSet) *renderFlags {
+	var defaults = videogenerator.DefaultConfig()
+	var f = &renderFlags{}
+	fs.StringVar(&f.project, "project", "", "YAML, JSON or TOML project file with the settings, which the other options override")
+	fs.StringVar(&f.audio, "audio", "", "recording to play instead of the synthesized MIDI file")
+	fs.StringVar(&f.synth, "synth", "timidity", "audio synthesizer: timidity, fluidsynth or builtin (default builtin with --soundfont)")
+	fs.StringVar(&f.soundFont, "soundfont", "", "SF2 sound font played by the fluidsynth and builtin synths")
+	fs.StringVar(&f.resolution, "resolution", "1080p", "video size: 1080p, 720p, 480p, 360p or WIDTHxHEIGHT")
+	fs.IntVar(&f.fps, "fps", defaults.FPS, "frames per second")
+	fs.StringVar(&f.keyboard, "octaves", "7", "keys drawn: 1 to 10 octaves around middle C, or 25keys, 49keys, 61keys, 76keys, 88keys")
+	fs.StringVar(&f.theme, "theme", defaults.Theme.Name, `color theme, see "piano-video themes"`)
+	fs.StringVar(&f.colorBy, "color-by", "track", "color notes by track, channel or instrument")
+	fs.Float64Var(&f.leadIn, "lead-in", defaults.StartDelaySec, "seconds of falling notes before the music starts")
+	fs.IntVar(&f.workers, "workers", defaults.Workers, "frames drawn at a time")
+
+	fs.BoolVar(&f.pedals, "pedals", defaults.ShowPedalLane, "draw the pedal lane under the keyboard")
+	fs.BoolVar(&f.sustainTails, "sustain-tails", defaults.ShowSustainTails, "draw the tails of notes held by the sustain pedal")
+	fs.BoolVar(&f.lyrics, "lyrics", defaults.ShowLyrics, "show lyrics and karaoke text")
+	fs.BoolVar(&f.drumStrip, "drum-strip", defaults.ShowDrumStrip, "draw drum hits as pads above the notes")
+	fs.BoolVar(&f.drumKeys, "drum-keys", defaults.DrumsOnKeyboard, "draw drum hits as notes on the keyboard too")
+	fs.BoolVar(&f.chapters, "chapters", defaults.WriteChapters, "write MIDI markers as video chapters")
+	fs.BoolVar(&f.subtitles, "subtitles", defaults.WriteSubtitles, "write MIDI markers as .vtt and .srt files next to the video")
+
+	fs.StringVar(&f.tracks, "tracks", "", "comma separated track numbers to draw, counting from 0 (default all)")
+	fs.StringVar(&f.channels, "channels", "", "comma separated MIDI channels to draw, 1 to 16 (default all)")
+	fs.StringVar(&f.audioTracks, "audio-tracks", "", "comma separated track numbers to play (default all)")
+	fs.StringVar(&f.audioChannels, "audio-channels", "", "comma separated MIDI channels to play (default all)")
+	return f
+}
+
+func parseList(value string) ([]int, error) {
+	var list = []int{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid number %q in %q", item, value)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+// parseChannels reads channels numbered 1 to 16, as MIDI software shows
+// them, into the 0 to 15 channel numbers of the MIDI messages.
+func parseChannels(value string) ([]byte, error) {
+	list, err := parseList(value)
+	if err != nil {
+		return nil, err
+	}
+	var channels = []byte{}
+	for _, n := range list {
+		if n < 1 || n > 16 {
+			return nil, fmt.Errorf("invalid channel %d, want 1 to 16", n)
+		}
+		channels = append(channels, byte(n-1))
+	}
+	return channels, nil
+}
+
+// audioRenderer picks the synth given on the command line. Only one of
+// --synth and --soundfont may be given, the other then coming from the
+// project's synth: a sound font alone switches timidity to the builtin synth.
+func (f *renderFlags) audioRenderer(set map[string]bool, current videogenerator.AudioRenderer) (videogenerator.AudioRenderer, error) {
+	var synth, soundFont = "timidity", ""
+	switch current := current.(type) {
+	case videogenerator.FluidSynth:
+		synth, soundFont = "fluidsynth", current.SoundFontPath
+	case videogenerator.SoundFontSynth:
+		synth, soundFont = "builtin", current.SoundFontPath
+	}
+	if set["soundfont"] {
+		soundFont = f.soundFont
+		if synth == "timidity" {
+			synth = "builtin"
+		}
+	}
+	if set["synth"] {
+		synth = f.synth
+	}
+	return videogenerator.ParseSynth(synth, soundFont)
+}
+
+// apply sets the options given on the command line on config, leaving the
+// others as they are.
+func (f *renderFlags) apply(fs *flag.FlagSet, config *videogenerator.Config) error {
+	var set = map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+	var err error
+
+	if set["resolution"] {
+		if config.Resolution, err = videogenerator.ParseResolution(f.resolution); err != nil {
+			return err
+		}
+	}
+	if set["octaves"] {
+		if config.LowestNote, config.HighestNote, err = videogenerator.ParseKeyboard(f.keyboard); err != nil {
+			return err
+		}
+	}
+	if set["color-by"] {
+		if config.ColorNotesBy, err = videogenerator.ParseColorMode(f.colorBy); err != nil {
+			return err
+		}
+	}
+	if set["theme"] {
+		var theme, found = videogenerator.ThemeByName(f.theme)
+		if !found {
+			return fmt.Errorf(`unknown theme %q, see "piano-video themes"`, f.theme)
+		}
+		config.Theme = theme
+	}
+	if set["fps"] {
+		if f.fps < 1 {
+			return fmt.Errorf("invalid fps %d", f.fps)
+		}
+		config.FPS = f.fps
+	}
+	if set["lead-in"] {
+		if f.leadIn < 0 {
+			return fmt.Errorf("invalid lead-in %g", f.leadIn)
+		}
+		config.StartDelaySec = f.leadIn
+	}
+	if set["workers"] {
+		config.Workers = f.workers
+	}
+	if set["audio"] {
+		config.AudioFilePath = f.audio
+	}
+	if set["synth"] || set["soundfont"] {
+		if config.AudioRenderer, err = f.audioRenderer(set, config.AudioRenderer); err != nil {
+			return err
+		}
+	}
+
+	var bools = map[string]struct {
+		value   bool
+		setting *bool
+	}{
+		"pedals":        {f.pedals, &config.ShowPedalLane},
+		"sustain-tails": {f.sustainTails, &config.ShowSustainTails},
+		"lyrics":        {f.lyrics, &config.ShowLyrics},
+		"drum-strip":    {f.drumStrip, &config.ShowDrumStrip},
+		"drum-keys":     {f.drumKeys, &config.DrumsOnKeyboard},
+		"chapters":      {f.chapters, &config.WriteChapters},
+		"subtitles":     {f.subtitles, &config.WriteSubtitles},
+	}
+	for name, b := range bools {
+		if set[name] {
+			*b.setting = b.value
+		}
+	}
+
+	if set["tracks"] {
+		if config.Selection.Draw.IncludeTracks, err = parseList(f.tracks); err != nil {
+			return err
+		}
+	}
+	if set["channels"] {
+		if config.Selection.Draw.IncludeChannels, err = parseChannels(f.channels); err != nil {
+			return err
+		}
+	}
+	if set["audio-tracks"] {
+		if config.Selection.Audio.IncludeTracks, err = parseList(f.audioTracks); err != nil {
+			return err
+		}
+	}
+	if set["audio-channels"] {
+		if config.Selection.Audio.IncludeChannels, err = parseChannels(f.audioChannels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderJob is what render and preview work on: the MIDI file and the
+// settings, from the project file when given and then the command line.
+type renderJob struct {
+	midiFilePath  string
+	projectOutput string
+	config        videogenerator.Config
+}
+
+func (f *renderFlags) job(fs *flag.FlagSet, positional []string) (renderJob, error) {
+	var job = renderJob{config: videogenerator.DefaultConfig()}
+	if f.project != "" {
+		p, err := project.Load(f.project)
+		if err != nil {
+			return job, err
+		}
+		job.config, _ = p.Config()
+		job.midiFilePath = p.InputPath()
+		job.projectOutput = p.OutputPath()
+	}
+
+	if len(positional) > 0 {
+		job.midiFilePath = positional[0]
+	}
+	if job.midiFilePath == "" {
+		return job, usageError(fs, errors.New("no MIDI file given, either as argument or as input of the project"))
+	}
+	if err := f.apply(fs, &job.config); err != nil {
+		return job, usageError(fs, err)
+	}
+	return job, nil
+}
+
+// outputPath picks the first path set and makes its folder.
+func outputPath(paths ...string) (string, error) {
+	for _, path := range paths {
+		if path != "" {
+			return path, os.MkdirAll(filepath.Dir(path), 0755)
+		}
+	}
+	return "", errors.New("no output path")
+}
+
+// defaultOutputPath puts the output next to the others in the output
+// folder, named after the MIDI file.
+func defaultOutputPath(midiFilePath string, extension string) string {
+	var name = strings.TrimSuffix(filepath.Base(midiFilePath), filepath.Ext(midiFilePath))
+	return filepath.Join("output", name+extension)
+}
+
+func runRender(args []string, stdout, stderr io.Writer) error {
+	var fs = newFlagSet("render", stderr)
+	var output = fs.String("o", "", "output video path (default output/<name>.mp4)")
+	var debugFrames = fs.Bool("debug-frames", false, "save the frames as PNG images in the frames folder and keep them, rather than streaming them to ffmpeg")
+	var flags = addRenderFlags(fs)
+	positional, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	job, err := flags.job(fs, positional)
+	if err != nil {
+		return err
+	}
+	job.config.DebugPNGFrames = *debugFrames
+	outputVideoPath, err := outputPath(*output, job.projectOutput, defaultOutputPath(job.midiFilePath, ".mp4"))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	job.config.Progress = printProgress(stdout)
+	var startTime = time.Now()
+	if err := videogenerator.NewRenderer(job.config).Render(ctx, job.midiFilePath, outputVideoPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Video generated in %.1f seconds: %s\n", time.Since(startTime).Seconds(), outputVideoPath)
+	return nil
+}
+
+var stageLabels = map[videogenerator.Stage]string{
+	videogenerator.StageParse:  "Reading the MIDI file",
+	videogenerator.StageAudio:  "Synthesizing the audio",
+	videogenerator.StageFrames: "Drawing the frames",
+	videogenerator.StageEncode: "Encoding the video",
+}
+
+// printProgress returns a Config.Progress printing each stage and, every
+// few seconds, the frames drawn.
+func printProgress(w io.Writer) func(videogenerator.Progress) {
+	var stage videogenerator.Stage
+	var lastPrint time.Time
+	return func(p videogenerator.Progress) {
+		if p.Stage != stage {
+			stage = p.Stage
+			fmt.Fprintf(w, "%s...\n", stageLabels[stage])
+			return
+		}
+		if p.Stage != videogenerator.StageFrames || (time.Since(lastPrint) < 5*time.Second && p.FramesDone < p.FramesTotal) {
+			return
+		}
+		lastPrint = time.Now()
+		fmt.Fprintf(w, "  %d/%d frames, %s left\n", p.FramesDone, p.FramesTotal, p.ETA.Round(time.Second))
+	}
+}
+
+func runPreview(args []string, stdout, stderr io.Writer) error {
+	var fs = newFlagSet("preview", stderr)
+	var output = fs.String("o", "", "output image path (default output/<name>.png)")
+	var seconds = fs.Float64("t", 0, "time of the frame in seconds from the start of the video, lead-in included")
+	var flags = addRenderFlags(fs)
+	positional, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	job, err := flags.job(fs, positional)
+	if err != nil {
+		return err
+	}
+	outputImagePath, err := outputPath(*output, defaultOutputPath(job.midiFilePath, ".png"))
+	if err != nil {
+		return err
+	}
+
+	if err := videogenerator.NewRenderer(job.config).Preview(job.midiFilePath, *seconds, outputImagePath); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Frame at %.2fs saved: %s\n", *seconds, outputImagePath)
+	return nil
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"piano-video/server"
+	"time"
+)
+
+func runServer(args []string, stdout, stderr io.Writer) error {
+	var fs = newFlagSet("server", stderr)
+	var addr = fs.String("addr", ":8080", "address to listen on")
+	var options = server.Options{}
+	fs.StringVar(&options.WorkDir, "dir", "", "folder of the jobs' files (default a piano-video folder in the system's temporary folder)")
+	fs.IntVar(&options.Workers, "workers", 1, "videos rendered at a time")
+	fs.IntVar(&options.QueueSize, "queue", 16, "jobs waiting for a worker before new ones are refused")
+	fs.Int64Var(&options.MaxUploadBytes, "max-upload", 8<<20, "largest upload accepted, in bytes")
+	fs.DurationVar(&options.KeepFinished, "keep", 24*time.Hour, "how long finished jobs and their videos are kept")
+	fs.StringVar(&options.SoundFont, "soundfont", "", "SF2 sound font to synthesize the jobs' audio with, rather than timidity")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	s, err := server.New(options)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var httpServer = &http.Server{Addr: *addr, Handler: s}
+	// Closing the jobs' server ends the event streams, which would keep
+	// the HTTP server from shutting down.
+	httpServer.RegisterOnShutdown(s.Close)
+	var served = make(chan error, 1)
+	go func() {
+		served <- httpServer.ListenAndServe()
+	}()
+	fmt.Fprintf(stdout, "Listening on %s\n", *addr)
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	fmt.Fprintln(stdout, "Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
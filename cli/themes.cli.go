@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"piano-video/videogenerator"
+)
+
+func runThemes(args []string, stdout, stderr io.Writer) error {
+	var fs = newFlagSet("themes", stderr)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	var defaultTheme = videogenerator.DefaultConfig().Theme.Name
+	for _, theme := range videogenerator.Themes() {
+		var name = theme.Name
+		if name == defaultTheme {
+			name += " (default)"
+		}
+		fmt.Fprintf(stdout, "%-16s %s\n", name, theme.Description)
+	}
+	return nil
+}
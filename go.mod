@@ -3,8 +3,10 @@ module piano-video
 go 1.25.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/fogleman/gg v1.3.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/gorilla/mux v1.8.1
 	golang.org/x/image v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,107 @@
+package midiparser
+
+import "sort"
+
+const (
+	ControllerSustain   byte = 64
+	ControllerSostenuto byte = 66
+	ControllerSoft      byte = 67
+)
+
+// PedalSpan is a stretch of ticks during which a pedal is held down.
+type PedalSpan struct {
+	OnTick  int `json:"on_tick"`
+	OffTick int `json:"off_tick"`
+}
+
+// IsPedalDown reports whether a pedal controller value means the pedal is
+// pressed. Values in between are half pedal depths.
+func IsPedalDown(value byte) bool {
+	return value >= 64
+}
+
+func (p *parser) controlChange(channel, controller, value byte) {
+	if _, exists := p.controlChanges[channel]; !exists {
+		p.controlChanges[channel] = map[byte][]ControlChange{}
+	}
+	p.controlChanges[channel][controller] = append(p.controlChanges[channel][controller], ControlChange{
+		Controller: controller,
+		Value:      value,
+		OnTick:     p.track().Time,
+		Channel:    channel,
+		Track:      p.trackIndex,
+	})
+}
+
+// sortControlChanges merges the timelines collected from every track.
+func (p *parser) sortControlChanges() {
+	for _, controllers := range p.controlChanges {
+		for _, changes := range controllers {
+			sort.SliceStable(changes, func(i, j int) bool {
+				return changes[i].OnTick < changes[j].OnTick
+			})
+		}
+	}
+}
+
+// Controller returns the tick ordered changes of one controller on a channel.
+func (m ParsedMidi) Controller(channel, controller byte) []ControlChange {
+	return m.ControlChanges[channel][controller]
+}
+
+func (m ParsedMidi) Sustain(channel byte) []ControlChange {
+	return m.Controller(channel, ControllerSustain)
+}
+
+func (m ParsedMidi) Sostenuto(channel byte) []ControlChange {
+	return m.Controller(channel, ControllerSostenuto)
+}
+
+func (m ParsedMidi) SoftPedal(channel byte) []ControlChange {
+	return m.Controller(channel, ControllerSoft)
+}
+
+// ControllerValueAt returns the value a controller holds at tick, or 0 if
+// it was never set before it.
+func (m ParsedMidi) ControllerValueAt(channel, controller byte, tick int) byte {
+	changes := m.Controller(channel, controller)
+	i := sort.Search(len(changes), func(i int) bool {
+		return changes[i].OnTick > tick
+	})
+	if i == 0 {
+		return 0
+	}
+	return changes[i-1].Value
+}
+
+// PedalSpans returns the stretches during which a pedal controller is down.
+// A pedal still held at the end of the song is released on its last tick.
+func (m ParsedMidi) PedalSpans(channel, controller byte) []PedalSpan {
+	var spans []PedalSpan
+	var down = false
+	var onTick int
+	for _, change := range m.Controller(channel, controller) {
+		if IsPedalDown(change.Value) && !down {
+			down = true
+			onTick = change.OnTick
+		} else if !IsPedalDown(change.Value) && down {
+			down = false
+			spans = append(spans, PedalSpan{OnTick: onTick, OffTick: change.OnTick})
+		}
+	}
+	if down {
+		spans = append(spans, PedalSpan{OnTick: onTick, OffTick: m.LastTick()})
+	}
+	return spans
+}
+
+// LastTick returns the length of the song in ticks.
+func (m ParsedMidi) LastTick() int {
+	var last int
+	for _, track := range m.Tracks {
+		if track.Time > last {
+			last = track.Time
+		}
+	}
+	return last
+}
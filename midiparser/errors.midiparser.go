@@ -0,0 +1,51 @@
+package midiparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidHeader     = errors.New("invalid MThd header")
+	ErrUnsupportedFormat = errors.New("unsupported track format")
+	ErrUnknownMeta       = errors.New("unknown meta event type")
+	ErrUnknownStatus     = errors.New("unknown status byte")
+	ErrChunkLength       = errors.New("chunk length mismatch")
+	ErrUnexpectedEOF     = errors.New("unexpected end of data")
+	ErrVarLenTooLong     = errors.New("variable length quantity longer than 4 bytes")
+	ErrTimeSignature     = errors.New("invalid time signature")
+	ErrSkippedData       = errors.New("skipped data outside the chunks")
+)
+
+// ParseError describes where a MIDI stream failed to decode. Track is -1 for
+// errors in the file header, Offset is the byte offset of the failing event
+// from the start of the stream and Status is the status byte being decoded.
+type ParseError struct {
+	Track  int
+	Offset int
+	Status byte
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Track < 0 {
+		return fmt.Sprintf("midiparser: header, offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("midiparser: track %d, offset %d, status 0x%02x: %v", e.Track, e.Offset, e.Status, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON writes the error with its location and message, as lenient
+// parsing reports its repairs in ParsedMidi.Warnings.
+func (e *ParseError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Track   int    `json:"track"`
+		Offset  int    `json:"offset"`
+		Status  byte   `json:"status"`
+		Message string `json:"message"`
+	}{e.Track, e.Offset, e.Status, e.Err.Error()})
+}
@@ -0,0 +1,182 @@
+package midiparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// channelMessageLengths holds the number of data bytes of each channel
+// message type.
+var channelMessageLengths = map[byte]int{
+	0x80: 2,
+	0x90: 2,
+	0xA0: 2,
+	0xB0: 2,
+	0xC0: 1,
+	0xD0: 1,
+	0xE0: 2,
+}
+
+// Filter copies the MIDI file in r to w, leaving out the notes keep
+// rejects. Meta and system exclusive events are always kept, as are the
+// other channel messages, such as program and control changes, of the
+// channels with notes kept, on whichever track they are: files often set up
+// their channels on a track of their own. The delta times of dropped events
+// carry over, so the timing is unchanged.
+func Filter(r io.Reader, w io.Writer, keep func(track int, channel byte, tick int) bool) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < 14 || !bytes.HasPrefix(data, []byte("MThd")) {
+		return &ParseError{Track: -1, Err: ErrInvalidHeader}
+	}
+	headerEnd := 8 + int(binary.BigEndian.Uint32(data[4:8]))
+	if headerEnd > len(data) {
+		return &ParseError{Track: -1, Err: ErrUnexpectedEOF}
+	}
+
+	// A first pass finds the channels with notes kept.
+	var usedChannels [16]bool
+	_, err = filterChunks(data, headerEnd, func(track int, status byte, tick int) bool {
+		if isNoteMessage(status) && keep(track, status&0x0F, tick) {
+			usedChannels[status&0x0F] = true
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	out, err := filterChunks(data, headerEnd, func(track int, status byte, tick int) bool {
+		if isNoteMessage(status) {
+			return keep(track, status&0x0F, tick)
+		}
+		return usedChannels[status&0x0F]
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// isNoteMessage reports whether a channel message status is about a note:
+// note off, note on or polyphonic aftertouch.
+func isNoteMessage(status byte) bool {
+	return status&0xF0 <= 0xA0
+}
+
+// filterChunks copies the header and the chunks following it, leaving out
+// the channel messages keep rejects.
+func filterChunks(data []byte, headerEnd int, keep func(track int, status byte, tick int) bool) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write(data[:headerEnd])
+	pos := headerEnd
+	for trackIndex := 0; pos+8 <= len(data); {
+		chunkId := data[pos : pos+4]
+		chunkBytes := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		chunkEnd := min(pos+8+chunkBytes, len(data))
+		if !bytes.Equal(chunkId, []byte("MTrk")) {
+			out.Write(data[pos:chunkEnd])
+			pos = chunkEnd
+			continue
+		}
+
+		events, err := filterTrack(data[pos+8:chunkEnd], func(status byte, tick int) bool {
+			return keep(trackIndex, status, tick)
+		})
+		if err != nil {
+			err.Track = trackIndex
+			err.Offset += pos + 8
+			return nil, err
+		}
+		out.WriteString("MTrk")
+		binary.Write(&out, binary.BigEndian, uint32(len(events)))
+		out.Write(events)
+		pos = chunkEnd
+		trackIndex++
+	}
+	return out.Bytes(), nil
+}
+
+// maxVarLen is the largest value a variable length quantity holds.
+const maxVarLen = 1<<(7*maxVarLenBytes) - 1
+
+// noOpEvent is an empty sequencer specific meta event, which carries the
+// part of a delta time too long for one variable length quantity.
+var noOpEvent = []byte{0xFF, 0x7F, 0x00}
+
+// writeDelta writes a delta time, splitting deltas longer than maxVarLen
+// across no-op events, as dropping events can add up such deltas.
+func writeDelta(out *bytes.Buffer, delta int) {
+	for ; delta > maxVarLen; delta -= maxVarLen {
+		writeVarLen(out, maxVarLen)
+		out.Write(noOpEvent)
+	}
+	writeVarLen(out, delta)
+}
+
+// writeVarLen writes a value up to maxVarLen as a variable length quantity.
+func writeVarLen(out *bytes.Buffer, value int) {
+	var buf [maxVarLenBytes]byte
+	i := len(buf) - 1
+	buf[i] = byte(value & 0x7F)
+	for value >>= 7; value > 0; value >>= 7 {
+		i--
+		buf[i] = byte(value&0x7F) | 0x80
+	}
+	out.Write(buf[i:])
+}
+
+func filterTrack(data []byte, keep func(status byte, tick int) bool) ([]byte, *ParseError) {
+	var out bytes.Buffer
+	p := newParser(data, Options{})
+	tick, pendingDelta := 0, 0
+	var runningStatus byte
+
+	for p.pos < len(data) {
+		p.eventOffset = p.pos
+		delta, _ := p.readVarLen()
+		tick += delta
+		pendingDelta += delta
+
+		status := p.readBytes(1)[0]
+		if status < 0x80 {
+			p.unreadByte()
+			status = runningStatus
+		} else if status < 0xF0 {
+			runningStatus = status
+		}
+		p.status = status
+
+		var event []byte
+		switch {
+		case status == 0xFF:
+			start := p.pos - 1
+			p.readBytes(1)
+			skipMeta(p)
+			event = data[start:min(p.pos, len(data))]
+		case status == 0xF0 || status == 0xF7:
+			start := p.pos - 1
+			statusf0(p, 0)
+			event = data[start:min(p.pos, len(data))]
+		case channelMessageLengths[status&0xF0] > 0:
+			channelData := p.readBytes(channelMessageLengths[status&0xF0])
+			if !keep(status, tick) {
+				continue
+			}
+			event = append([]byte{status}, channelData...)
+		default:
+			p.fail(ErrUnknownStatus)
+		}
+		if p.err != nil {
+			return nil, p.err.(*ParseError)
+		}
+
+		writeDelta(&out, pendingDelta)
+		out.Write(event)
+		pendingDelta = 0
+	}
+	return out.Bytes(), nil
+}
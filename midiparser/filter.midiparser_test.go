@@ -0,0 +1,155 @@
+package midiparser
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	// tickNote is what the test checks of a kept note.
+	type tickNote struct {
+		note, channel, on, off int
+	}
+	var trackName = []byte{0x00, 0xFF, 0x03, 0x04, 'l', 'e', 'f', 't'}
+	var twoChannels = trackBody(
+		trackName,
+		[]byte{0x00, 0x90, 60, 100, 0x00, 0x91, 48, 90},
+		[]byte{0x60, 0x80, 60, 0, 0x00, 0x81, 48, 0},
+		[]byte{0x00, 0x90, 62, 100, 0x60, 62, 0},
+	)
+	// Two dropped events with the longest delta, then a kept note: the
+	// deltas add up past what one variable length quantity holds.
+	var longDeltas = trackBody(
+		[]byte{0xFF, 0xFF, 0xFF, 0x7F, 0x91, 48, 90},
+		[]byte{0xFF, 0xFF, 0xFF, 0x7F, 0x81, 48, 0},
+		[]byte{0x10, 0x90, 60, 100, 0x10, 0x80, 60, 0},
+	)
+
+	var tests = []struct {
+		name string
+		data []byte
+		keep func(track int, channel byte, tick int) bool
+		want []tickNote
+		err  error
+	}{
+		{
+			name: "keep everything",
+			data: midiFile(96, twoChannels),
+			keep: func(int, byte, int) bool { return true },
+			want: []tickNote{{60, 0, 0, 96}, {48, 1, 0, 96}, {62, 0, 96, 192}},
+		},
+		{
+			name: "drop a channel",
+			data: midiFile(96, twoChannels),
+			keep: func(track int, channel byte, tick int) bool { return channel == 0 },
+			want: []tickNote{{60, 0, 0, 96}, {62, 0, 96, 192}},
+		},
+		{
+			name: "drop by tick",
+			data: midiFile(96, twoChannels),
+			keep: func(track int, channel byte, tick int) bool { return tick >= 96 },
+			want: []tickNote{{62, 0, 96, 192}},
+		},
+		{
+			name: "long accumulated deltas",
+			data: midiFile(96, longDeltas),
+			keep: func(track int, channel byte, tick int) bool { return channel == 0 },
+			want: []tickNote{{60, 0, 2*maxVarLen + 0x10, 2*maxVarLen + 0x20}},
+		},
+		{
+			name: "bad varlen",
+			data: midiFile(96, trackBody([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0x90, 60, 100})),
+			keep: func(int, byte, int) bool { return true },
+			err:  ErrVarLenTooLong,
+		},
+		{
+			name: "meta past the track",
+			data: midiFile(96, trackBody([]byte{0x00, 0xFF, 0x01, 0xFF, 0xFF, 0xFF, 0x7F})),
+			keep: func(int, byte, int) bool { return true },
+			err:  ErrChunkLength,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Filter(bytes.NewReader(test.data), &out, test.keep)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Filter() error = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			midi, err := Parse(&out)
+			if err != nil {
+				t.Fatalf("Parse() of the filtered file error = %v", err)
+			}
+			var got = []tickNote{}
+			for _, event := range midi.Tracks[0].Events {
+				got = append(got, tickNote{event.Note, int(event.Channel), event.OnTick, event.Offtick})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("notes = %v, want %v", got, test.want)
+			}
+			if midi.Tracks[0].Name != "left" && bytes.Contains(test.data, trackName) {
+				t.Errorf("track name = %q, want the meta event kept", midi.Tracks[0].Name)
+			}
+		})
+	}
+}
+
+func TestWriteDelta(t *testing.T) {
+	var tests = []struct {
+		delta int
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{0x80, []byte{0x81, 0x00}},
+		{maxVarLen, []byte{0xFF, 0xFF, 0xFF, 0x7F}},
+		{maxVarLen + 1, []byte{0xFF, 0xFF, 0xFF, 0x7F, 0xFF, 0x7F, 0x00, 0x01}},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		writeDelta(&out, test.delta)
+		if !bytes.Equal(out.Bytes(), test.want) {
+			t.Errorf("writeDelta(%#x) = % x, want % x", test.delta, out.Bytes(), test.want)
+		}
+	}
+}
+
+func TestFilterChannelSetup(t *testing.T) {
+	// A conductor track setting up channels 0 and 1, played by the next
+	// track.
+	var conductor = trackBody(
+		[]byte{0x00, 0xC0, 40, 0x00, 0xB0, 64, 127},
+		[]byte{0x00, 0xC1, 33, 0x00, 0xE1, 0x00, 0x50},
+	)
+	var notes = trackBody(
+		[]byte{0x00, 0x90, 60, 100, 0x00, 0x91, 48, 90},
+		[]byte{0x60, 0x80, 60, 0, 0x00, 0x81, 48, 0},
+	)
+	var keep = func(track int, channel byte, tick int) bool {
+		return track == 1 && channel == 0
+	}
+	var out bytes.Buffer
+	if err := Filter(bytes.NewReader(midiFile(96, conductor, notes)), &out, keep); err != nil {
+		t.Fatal(err)
+	}
+	midi, err := Parse(&out)
+	if err != nil {
+		t.Fatalf("Parse() of the filtered file error = %v", err)
+	}
+	if len(midi.Tracks[0].Events) != 0 || len(midi.Tracks[1].Events) != 1 || midi.Tracks[1].Events[0].Channel != 0 {
+		t.Errorf("notes = %v and %v, want the channel 0 note of the second track", midi.Tracks[0].Events, midi.Tracks[1].Events)
+	}
+	if program := midi.ProgramAt(0, 0); program.Patch != 40 {
+		t.Errorf("channel 0 patch = %d, want 40 from the conductor track", program.Patch)
+	}
+	if sustain := midi.Sustain(0); len(sustain) != 1 || sustain[0].Value != 127 {
+		t.Errorf("channel 0 sustain = %v, want the conductor track's", sustain)
+	}
+	if len(midi.ProgramChanges[1]) != 0 || len(midi.PitchBends[1]) != 0 {
+		t.Errorf("channel 1 setup = %v and %v, want it dropped with its notes", midi.ProgramChanges[1], midi.PitchBends[1])
+	}
+}
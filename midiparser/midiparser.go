@@ -1,22 +1,86 @@
 package midiparser
 
 import (
+	"bytes"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"strconv"
 )
 
-var allChannels = make(map[byte]Channel)
-var buffer = make([]byte, 2000)
-var prependByte, lastStatus byte
-var trackIndex = 0
-var allTracks = []Track{}
-var headerMeta HeaderMeta
+// parser holds the whole decoding state of a single MIDI stream, so every
+// call to Parse works on its own copy and parsers can run concurrently.
+type parser struct {
+	data       []byte
+	pos        int
+	channels   map[byte]Channel
+	tracks     []Track
+	headerMeta HeaderMeta
+	trackIndex int
+	lastStatus byte
+	openNotes  map[noteKey][]int
 
-func prepareReadBytes(bytes int) func(f *os.File) int {
-	return func(f *os.File) int {
-		readBytes(f, bytes)
+	controlChanges map[byte]map[byte][]ControlChange
+	programChanges map[byte][]ProgramChange
+	pitchBends     map[byte][]PitchBend
+	texts          []TextEvent
+	options        Options
+	warnings       []*ParseError
+	endOfTrack     bool
+	// trackEnd is the offset where the declared length of the track being
+	// read ends.
+	trackEnd int
+
+	// eventOffset and status locate the event being decoded for errors.
+	eventOffset int
+	status      byte
+	err         error
+}
+
+func newParser(data []byte, options Options) *parser {
+	return &parser{
+		data:      data,
+		trackEnd:  len(data),
+		channels:  make(map[byte]Channel),
+		openNotes: make(map[noteKey][]int),
+
+		controlChanges: make(map[byte]map[byte][]ControlChange),
+		programChanges: make(map[byte][]ProgramChange),
+		pitchBends:     make(map[byte][]PitchBend),
+		options:        options,
+	}
+}
+
+func (p *parser) newError(err error) *ParseError {
+	return &ParseError{
+		Track:  p.trackIndex,
+		Offset: p.eventOffset,
+		Status: p.status,
+		Err:    err,
+	}
+}
+
+// fail records the first decoding error; once set, the chunk loop stops and
+// parse returns it.
+func (p *parser) fail(err error) {
+	if p.err != nil {
+		return
+	}
+	p.err = p.newError(err)
+}
+
+// warn records a problem that lenient parsing worked around.
+func (p *parser) warn(err error) {
+	p.warnings = append(p.warnings, p.newError(err))
+}
+
+func (p *parser) track() *Track {
+	return &p.tracks[p.trackIndex]
+}
+
+func prepareReadBytes(bytes int) func(p *parser) int {
+	return func(p *parser) int {
+		p.readBytes(bytes)
 		return bytes
 	}
 }
@@ -29,164 +93,230 @@ func bytesToString(bts []byte) string {
 	return str
 }
 
-func readText() func(f *os.File) int {
-	return func(f *os.File) int {
-		len := readBytes(f, 1)[0]
-		bytesToString(readBytes(f, int(len))) // text
-		return int(len) + 1
+func readText(textType TextType) func(p *parser) int {
+	return func(p *parser) int {
+		len, lenBytes := p.readLength()
+		p.addText(textType, decodeText(p.readBytes(len)))
+		return len + lenBytes
 	}
 }
-func setBpm(f *os.File) int {
-	readBytes(f, 1) // irrelevant byte
-	bpm := float64(bytesToInt(readBytes(f, 3)))
+func skipMeta(p *parser) int {
+	len, lenBytes := p.readLength()
+	p.readBytes(len)
+	return len + lenBytes
+}
+func setBpm(p *parser) int {
+	p.readBytes(1) // irrelevant byte
+	bpm := float64(bytesToInt(p.readBytes(3)))
 	bpm = 60000000 / bpm
-	headerMeta.Tempos = append(headerMeta.Tempos, Tempo{
+	p.headerMeta.Tempos = append(p.headerMeta.Tempos, Tempo{
 		Bpm:    bpm,
-		OnTick: allTracks[trackIndex].Time,
+		OnTick: p.track().Time,
 	})
 	return 4
 }
-func timeSig(f *os.File) int {
-	readBytes(f, 1) // irrelevant byte
-	readBytes(f, 4) // time signature
+
+// maxTimeSignatureExponent is the largest power of two denominator, a
+// 128th note, accepted in time signatures.
+const maxTimeSignatureExponent = 7
+
+func timeSig(p *parser) int {
+	p.readBytes(1) // irrelevant byte
+	bts := p.readBytes(4)
+	if bts[0] == 0 || bts[1] > maxTimeSignatureExponent {
+		err := fmt.Errorf("%w %d/2^%d", ErrTimeSignature, bts[0], bts[1])
+		if p.options.Lenient {
+			p.warn(err)
+		} else {
+			p.fail(err)
+		}
+		return 5
+	}
+	p.headerMeta.TimeSignatures = append(p.headerMeta.TimeSignatures, TimeSignature{
+		Numerator:               int(bts[0]),
+		Denominator:             1 << bts[1],
+		ClocksPerClick:          int(bts[2]),
+		ThirtySecondsPerQuarter: int(bts[3]),
+		OnTick:                  p.track().Time,
+	})
 	return 5
 }
-func offset(f *os.File) int {
-	readBytes(f, 1) // irrelevant byte
-	readBytes(f, 5) // offset
+func keySig(p *parser) int {
+	p.readBytes(1) // irrelevant byte
+	bts := p.readBytes(2)
+	p.headerMeta.KeySignatures = append(p.headerMeta.KeySignatures, KeySignature{
+		Sharps: int(int8(bts[0])),
+		Minor:  bts[1] == 1,
+		OnTick: p.track().Time,
+	})
+	return 3
+}
+func offset(p *parser) int {
+	p.readBytes(1) // irrelevant byte
+	bts := p.readBytes(5)
+	p.headerMeta.SMPTEOffset = &SMPTEOffset{
+		FrameRate: smpteFrameRates[bts[0]>>5&3],
+		Hours:     int(bts[0] & 31),
+		Minutes:   int(bts[1]),
+		Seconds:   int(bts[2]),
+		Frames:    int(bts[3]),
+		SubFrames: int(bts[4]),
+	}
 	return 6
 }
-func midiChannelPrefix(f *os.File) int {
-	readBytes(f, 1) // irrelevant byte
-	readBytes(f, 1)
+func midiChannelPrefix(p *parser) int {
+	p.readBytes(1) // irrelevant byte
+	p.readBytes(1)
 	return 2
 }
-func midiPort(f *os.File) int {
-	readBytes(f, 1) // irrelevant byte
-	readBytes(f, 1)
+func endOfTrack(p *parser) int {
+	p.readBytes(1) // irrelevant byte
+	p.endOfTrack = true
+	p.closeOpenNotes()
+	return 1
+}
+func midiPort(p *parser) int {
+	p.readBytes(1) // irrelevant byte
+	p.readBytes(1)
 	return 2
 }
 
-var FFevents = map[byte]func(f *os.File) int{
+var FFevents = map[byte]func(p *parser) int{
 	0:   prepareReadBytes(1),
-	1:   readText(),
-	2:   readText(),
-	3:   readText(),
-	4:   readText(),
-	5:   readText(),
-	6:   readText(),
-	7:   readText(),
-	8:   readText(),
-	9:   readText(),
+	1:   readText(TextGeneric),
+	2:   readText(TextCopyright),
+	3:   readText(TextTrackName),
+	4:   readText(TextInstrumentName),
+	5:   readText(TextLyric),
+	6:   readText(TextMarker),
+	7:   readText(TextCuePoint),
+	8:   readText(TextProgramName),
+	9:   readText(TextDeviceName),
 	32:  midiChannelPrefix,
 	33:  midiPort,
-	47:  prepareReadBytes(1),
+	47:  endOfTrack,
 	81:  setBpm,
 	84:  offset,
 	88:  timeSig,
-	89:  prepareReadBytes(3),
-	127: readText(),
+	89:  keySig,
+	127: skipMeta,
 }
 
-func statusf0(f *os.File, channel byte) int {
-	bytesLen, bytesRead := readVarLen(f)
-	readBytes(f, bytesLen)
+func statusf0(p *parser, channel byte) int {
+	bytesLen, bytesRead := p.readLength()
+	p.readBytes(bytesLen)
 	return bytesLen + bytesRead
 }
 
-var events = map[byte]func(f *os.File, channel byte) int{
-	255: func(f *os.File, channel byte) int {
-		n := readBytes(f, 1)[0]
+var events = map[byte]func(p *parser, channel byte) int{
+	255: func(p *parser, channel byte) int {
+		n := p.readBytes(1)[0]
 		fn, ok := FFevents[n]
 		if ok {
-			return fn(f) + 1
+			return fn(p) + 1
 		}
-		log.Fatal("Unknown status value for FF ", n)
-		return 0
+		err := fmt.Errorf("%w 0x%02x", ErrUnknownMeta, n)
+		if !p.options.Lenient {
+			p.fail(err)
+			return 1
+		}
+		p.warn(err)
+		return skipMeta(p) + 1
 	},
 	240: statusf0,
-	128: func(f *os.File, channel byte) int {
-		key := readBytes(f, 2)[0]
-		var index int
-		for i := len(allTracks[trackIndex].Events) - 1; i > 0; i-- {
-			n := allTracks[trackIndex].Events[i]
-			if n.Note == int(key) {
-				index = i
-				break
-			}
-		}
-		if trackIndex == 2 {
-			fmt.Println(index, trackIndex, allTracks[trackIndex].Time)
-		}
-		allTracks[trackIndex].Events[index].Offtick = allTracks[trackIndex].Time
+	247: statusf0,
+	128: func(p *parser, channel byte) int {
+		bts := p.readBytes(2)
+		p.noteOff(channel, bts[0], bts[1])
 		c := 2
 		return c
 	},
-	144: func(f *os.File, channel byte) int {
-		bts := readBytes(f, 2)
+	144: func(p *parser, channel byte) int {
+		bts := p.readBytes(2)
 		key := bts[0]
 		velocity := bts[1]
 		on := velocity != 0
 		if on {
-			allTracks[trackIndex].Events = append(allTracks[trackIndex].Events, Event{Note: int(key), OnTick: allTracks[trackIndex].Time, Channel: channel})
+			p.noteOn(channel, key, velocity)
 		} else {
-			var index int
-			for i := len(allTracks[trackIndex].Events) - 1; i > 0; i-- {
-				n := allTracks[trackIndex].Events[i]
-				if n.Note == int(key) {
-					index = i
-					break
-				}
-			}
-			allTracks[trackIndex].Events[index].Offtick = allTracks[trackIndex].Time
+			p.noteOff(channel, key, 64) // implied by a zero velocity note on
 		}
 		c := 2
 		return c
 	},
-	176: func(f *os.File, channel byte) int {
-		readBytes(f, 2)
+	176: func(p *parser, channel byte) int {
+		bts := p.readBytes(2)
+		p.controlChange(channel, bts[0], bts[1])
 		c := 2
 		return c
 	},
-	192: func(f *os.File, channel byte) int {
-		patchNumber := readBytes(f, 1)[0]
-		instrument := instrumentsTable[int(patchNumber)]
-		if instrument != "" {
-			allChannels[channel] = Channel{Instrument: instrument, Patch: patchNumber}
-		}
+	192: func(p *parser, channel byte) int {
+		patchNumber := p.readBytes(1)[0] & 0x7F
+		p.programChange(channel, patchNumber)
 		c := 1
 		return c
 	},
-	224: func(f *os.File, channel byte) int {
-		_ = readBytes(f, 2)[0]
+	224: func(p *parser, channel byte) int {
+		bts := p.readBytes(2)
+		p.pitchBend(channel, (int(bts[1]&0x7F)<<7|int(bts[0]&0x7F))-8192)
 		c := 2
 		return c
 	},
 }
 
-func readMThd(f *os.File) {
-	readBytes(f, 8)
-	trackFileFormat := bytesToInt(readBytes(f, 2))
+func (p *parser) readMThd() {
+	p.trackIndex = -1
+	if bytesToString(p.readBytes(4)) != "MThd" {
+		p.fail(ErrInvalidHeader)
+		return
+	}
+	p.readBytes(4)
+	trackFileFormat := bytesToInt(p.readBytes(2))
 	if trackFileFormat == 2 {
-		log.Fatal("can't process track format 2")
+		p.fail(fmt.Errorf("%w %d", ErrUnsupportedFormat, trackFileFormat))
+		return
+	}
+	tracksNumber := bytesToInt(p.readBytes(2))
+	p.headerMeta.TracksNumber = tracksNumber
+
+	division := p.readBytes(2)
+	if division[0]&0x80 == 0 {
+		p.headerMeta.QuarterValue = bytesToInt(division)
+		return
+	}
+	// SMPTE timing: negative frames per second in the high byte and ticks
+	// per frame in the low one.
+	framesPerSecond := float64(-int8(division[0]))
+	if framesPerSecond == 29 {
+		framesPerSecond = 29.97
+	}
+	p.headerMeta.SMPTEFramesPerSecond = framesPerSecond
+	p.headerMeta.TicksPerFrame = int(division[1])
+	if p.headerMeta.TicksPerFrame == 0 {
+		p.fail(fmt.Errorf("%w: 0 ticks per frame", ErrInvalidHeader))
 	}
-	tracksNumber := bytesToInt(readBytes(f, 2))
-	headerMeta.TracksNumber = tracksNumber
-	headerMeta.QuarterValue = bytesToInt(readBytes(f, 2))
 }
 
-func readBytes(f *os.File, bytes int) []byte {
+// readBytes returns the next bytes of the stream. Reads past the end of the
+// data are padded with zeros and fail with ErrUnexpectedEOF.
+func (p *parser) readBytes(bytes int) []byte {
 	tmp := make([]byte, bytes)
-	if prependByte != 0 {
-		tmp = tmp[:bytes-1]
-		f.Read(tmp)
-		tmp = append([]byte{prependByte}, tmp...)
-		prependByte = 0
-		return tmp
-	}
-	f.Read(tmp)
+	if p.pos < len(p.data) {
+		copy(tmp, p.data[p.pos:])
+	}
+	if p.pos+bytes > len(p.data) {
+		p.fail(ErrUnexpectedEOF)
+	}
+	p.pos += bytes
 	return tmp
 }
+
+// unreadByte steps back over the last byte read, so a running status data
+// byte can be consumed again by the event handler.
+func (p *parser) unreadByte() {
+	p.pos--
+}
+
 func bytesToInt(bytes []byte) int {
 	str := ""
 	for _, b := range bytes {
@@ -196,95 +326,211 @@ func bytesToInt(bytes []byte) int {
 	return int(deltaSum)
 }
 
-func readVarLen(f *os.File) (int, int) {
-	var value int
-	var c byte
-	bytesRead := 1
-	value = int(readBytes(f, 1)[0])
-
-	if value&0x80 != 0 {
-		value &= 0x7F
-
-		for {
-			c = readBytes(f, 1)[0]
-			bytesRead++
-
-			value = (int(value) << 7) + int(c&0x7F)
+// maxVarLenBytes is the longest variable length quantity the format
+// allows, holding up to 0x0FFFFFFF.
+const maxVarLenBytes = 4
 
-			if c&0x80 == 0 {
-				break
-			}
+// readVarLen reads a variable length quantity and returns it with the
+// number of bytes it took. Longer quantities fail with ErrVarLenTooLong.
+func (p *parser) readVarLen() (int, int) {
+	var value int
+	for bytesRead := 1; bytesRead <= maxVarLenBytes; bytesRead++ {
+		c := p.readBytes(1)[0]
+		value = value<<7 | int(c&0x7F)
+		if c&0x80 == 0 {
+			return value, bytesRead
 		}
 	}
+	p.fail(ErrVarLenTooLong)
+	return 0, maxVarLenBytes
+}
 
-	return int(value), bytesRead
+// readLength reads the length of the data of a meta or sysex event. Lengths
+// going past the end of the track fail with ErrChunkLength, or past the end
+// of the data in lenient mode, where the declared track length may be
+// wrong, so a corrupt length never makes readBytes allocate more than the
+// data holds.
+func (p *parser) readLength() (int, int) {
+	length, lengthBytes := p.readVarLen()
+	var end = len(p.data)
+	if !p.options.Lenient {
+		end = min(p.trackEnd, end)
+	}
+	if length > end-p.pos {
+		p.fail(fmt.Errorf("%w: event length %d past the end of the track", ErrChunkLength, length))
+		return 0, lengthBytes
+	}
+	return length, lengthBytes
 }
 
-func readEvent(f *os.File) int {
-	deltaSumInt, deltaBytes := readVarLen(f)
-	allTracks[trackIndex].Time += deltaSumInt
+func (p *parser) readEvent() int {
+	p.eventOffset = p.pos
+	deltaSumInt, deltaBytes := p.readVarLen()
+	p.track().Time += deltaSumInt
 
-	status := readBytes(f, 1)[0]
+	status := p.readBytes(1)[0]
+	p.status = status
 
 	if status < 128 {
-		prependByte = status
-		channel := lastStatus & 15 // last 4 bits
+		p.unreadByte()
+		p.status = p.lastStatus
+		channel := p.lastStatus & 15 // last 4 bits
 
-		v, ok := events[lastStatus]
+		v, ok := events[p.lastStatus]
 		if ok {
-			return v(f, channel) + deltaBytes
+			return v(p, channel) + deltaBytes
 		}
-		eventId := lastStatus & 240 // first 4 bits
+		eventId := p.lastStatus & 240 // first 4 bits
 		v, ok = events[eventId]
 		if ok {
-			return v(f, channel) + deltaBytes
+			return v(p, channel) + deltaBytes
 		}
-		log.Fatal("ERROR unknown status: ", lastStatus)
+		p.fail(ErrUnknownStatus)
+		return deltaBytes
 	}
-	lastStatus = status
+	p.lastStatus = status
 	channel := status & 15  // last 4 bits
 	eventId := status & 240 // first 4 bits
 
 	v, ok := events[eventId]
 	if ok && status < 240 {
-		return v(f, channel) + deltaBytes + 1
+		return v(p, channel) + deltaBytes + 1
 	}
 	v, ok = events[status]
 	if ok {
-		return v(f, channel) + deltaBytes + 1
+		return v(p, channel) + deltaBytes + 1
 	}
 
-	log.Fatal("ERROR STATUS: ", status)
-	return 0
+	p.fail(ErrUnknownStatus)
+	return deltaBytes + 1
 }
-func readChunk(f *os.File) {
-	buffer = buffer[:4]
-	f.Read(buffer)
-	buffer = buffer[:4]
-	f.Read(buffer)
-	chunkBytes := bytesToInt(buffer)
+func (p *parser) readChunk() {
+	p.eventOffset = p.pos
+	p.status = 0
+	p.endOfTrack = false
+	p.readBytes(4)
+	chunkBytes := bytesToInt(p.readBytes(4))
+	p.trackEnd = p.pos + chunkBytes
 	bytesRead := 0
-	for bytesRead < chunkBytes {
-		bytesRead += readEvent(f)
+	for bytesRead < chunkBytes && p.err == nil {
+		bytesRead += p.readEvent()
+		if p.options.Lenient && p.endOfTrack {
+			break
+		}
+	}
+	if p.options.Lenient && p.err == nil && !p.endOfTrack {
+		// The declared length ran out before End of Track, keep reading
+		// events until we meet it or the data does.
+		for !p.endOfTrack && p.err == nil && p.pos < len(p.data) && !p.atChunkHeader() {
+			bytesRead += p.readEvent()
+		}
 	}
-	if bytesRead != chunkBytes {
-		log.Fatal("No match. Must be a bug or corrupt midi: Read should Be: ", bytesRead, "==", chunkBytes)
+	if p.err == nil && bytesRead != chunkBytes {
+		p.fail(fmt.Errorf("%w: read %d bytes, chunk declares %d", ErrChunkLength, bytesRead, chunkBytes))
 	}
 }
 
-func ParseFile(f *os.File) (ParsedMidi, error) {
-	readMThd(f)
-	tracksNumber := headerMeta.TracksNumber
-	allTracks = make([]Track, tracksNumber)
-	for i := 0; i < tracksNumber; i++ {
-		readChunk(f)
-		trackIndex++
+func (p *parser) atChunkHeader() bool {
+	return bytes.HasPrefix(p.data[p.pos:], []byte("MTrk"))
+}
+
+// skipToChunk moves past the bytes before the next MTrk header, or to the
+// end of the data if there is none, so lenient parsing reads the next track
+// into the slot of the current one.
+func (p *parser) skipToChunk() {
+	if p.pos >= len(p.data) || p.atChunkHeader() {
+		return
+	}
+	p.eventOffset = p.pos
+	p.status = 0
+	next := bytes.Index(p.data[p.pos:], []byte("MTrk"))
+	if next < 0 {
+		next = len(p.data) - p.pos
 	}
+	p.warn(fmt.Errorf("%w: %d bytes before MTrk chunk", ErrSkippedData, next))
+	p.pos += next
+}
+
+// resync turns the pending error into a warning, closes the notes the
+// broken track left open and moves to the next MTrk header, so the
+// remaining tracks can still be decoded.
+func (p *parser) resync() {
+	p.warnings = append(p.warnings, p.err.(*ParseError))
+	p.err = nil
+	p.closeOpenNotes()
+
+	from := min(max(p.eventOffset, 0), len(p.data))
+	next := bytes.Index(p.data[from:], []byte("MTrk"))
+	if next < 0 {
+		p.pos = len(p.data)
+		return
+	}
+	p.pos = from + next
+}
+
+func (p *parser) parse() (ParsedMidi, error) {
+	p.readMThd()
+	if p.err != nil {
+		return ParsedMidi{}, p.err
+	}
+	tracksNumber := p.headerMeta.TracksNumber
+	p.tracks = make([]Track, tracksNumber)
+	for p.trackIndex = 0; p.trackIndex < tracksNumber; p.trackIndex++ {
+		if p.options.Lenient {
+			p.skipToChunk()
+		}
+		if p.options.Lenient && p.pos >= len(p.data) {
+			p.eventOffset = p.pos
+			p.status = 0
+			p.warn(fmt.Errorf("%w: missing %d of %d tracks", ErrUnexpectedEOF, tracksNumber-p.trackIndex, tracksNumber))
+			break
+		}
+		p.readChunk()
+		if p.err != nil {
+			if !p.options.Lenient {
+				return ParsedMidi{}, p.err
+			}
+			p.resync()
+		}
+		p.closeOpenNotes()
+	}
+	p.sortControlChanges()
+	p.sortChannelTimelines()
+	p.headerMeta.sortSignatures()
+	p.sortTexts()
+	p.nameChannels()
 	var parsedMidi = ParsedMidi{
-		Tracks:   allTracks,
-		Channels: allChannels,
-		Meta:     headerMeta,
+		Tracks:         p.tracks,
+		Channels:       p.channels,
+		ControlChanges: p.controlChanges,
+		ProgramChanges: p.programChanges,
+		PitchBends:     p.pitchBends,
+		Texts:          p.texts,
+		Meta:           p.headerMeta,
+		Warnings:       p.warnings,
 	}
 
 	return parsedMidi, nil
 }
+
+// Parse decodes a standard MIDI file from r. All decoding state is local to
+// the call, so Parse can be used from several goroutines at once. Malformed
+// input is reported as a *ParseError wrapping one of the Err* sentinels.
+func Parse(r io.Reader) (ParsedMidi, error) {
+	return ParseWithOptions(r, Options{})
+}
+
+// ParseWithOptions is Parse with explicit options. In lenient mode decoding
+// problems inside tracks are collected in ParsedMidi.Warnings instead of
+// failing the whole file.
+func ParseWithOptions(r io.Reader, options Options) (ParsedMidi, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ParsedMidi{}, err
+	}
+	return newParser(data, options).parse()
+}
+
+func ParseFile(f *os.File) (ParsedMidi, error) {
+	return Parse(f)
+}
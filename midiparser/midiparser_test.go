@@ -0,0 +1,229 @@
+package midiparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// endOfTrackEvent closes the track bodies of the test files.
+var endOfTrackEvent = []byte{0x00, 0xFF, 0x2F, 0x00}
+
+// midiFile builds a format 1 file with the given division out of track
+// bodies, each wrapped in an MTrk chunk as is.
+func midiFile(division uint16, tracks ...[]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("MThd")
+	binary.Write(&b, binary.BigEndian, []uint16{0, 6, 1, uint16(len(tracks)), division})
+	for _, track := range tracks {
+		b.WriteString("MTrk")
+		binary.Write(&b, binary.BigEndian, uint32(len(track)))
+		b.Write(track)
+	}
+	return b.Bytes()
+}
+
+// trackBody joins events and ends them with End of Track.
+func trackBody(events ...[]byte) []byte {
+	return append(bytes.Join(events, nil), endOfTrackEvent...)
+}
+
+func TestReadVarLen(t *testing.T) {
+	var tests = []struct {
+		name      string
+		data      []byte
+		value     int
+		bytesRead int
+		err       error
+	}{
+		{"one byte", []byte{0x40}, 0x40, 1, nil},
+		{"two bytes", []byte{0x81, 0x00}, 0x80, 2, nil},
+		{"largest", []byte{0xFF, 0xFF, 0xFF, 0x7F}, 0x0FFFFFFF, 4, nil},
+		{"five bytes", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x7F}, 0, 4, ErrVarLenTooLong},
+		{"truncated", []byte{0x81}, 0x80, 2, ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var p = newParser(test.data, Options{})
+			value, bytesRead := p.readVarLen()
+			if value != test.value || bytesRead != test.bytesRead {
+				t.Errorf("readVarLen() = %#x, %d, want %#x, %d", value, bytesRead, test.value, test.bytesRead)
+			}
+			if !errors.Is(p.err, test.err) {
+				t.Errorf("error = %v, want %v", p.err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var note = []byte{0x00, 0x90, 60, 100, 0x60, 0x80, 60, 0}
+	var valid = midiFile(96, trackBody(note))
+
+	var format2 = bytes.Clone(valid)
+	format2[9] = 2
+	// The last byte of the track length, which the header's 14 bytes and
+	// the MTrk tag precede.
+	var shortChunk = bytes.Clone(valid)
+	shortChunk[21] -= 2
+
+	var tests = []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"valid", valid, nil},
+		{"not a MIDI file", []byte("RIFF\x00\x00\x00\x00WAVE"), ErrInvalidHeader},
+		{"format 2", format2, ErrUnsupportedFormat},
+		{"SMPTE without ticks per frame", midiFile(0xE800, trackBody(note)), ErrInvalidHeader},
+		{"truncated", valid[:len(valid)-3], ErrUnexpectedEOF},
+		{"unknown status", midiFile(96, trackBody([]byte{0x00, 0xF4})), ErrUnknownStatus},
+		{"running status first", midiFile(96, trackBody([]byte{0x00, 60, 100})), ErrUnknownStatus},
+		{"unknown meta", midiFile(96, trackBody([]byte{0x00, 0xFF, 0x60, 0x00})), ErrUnknownMeta},
+		{"chunk shorter than its events", shortChunk, ErrChunkLength},
+		{
+			"length varlen too long",
+			midiFile(96, trackBody([]byte{0x00, 0xFF, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F})),
+			ErrVarLenTooLong,
+		},
+		{"delta varlen too long", midiFile(96, trackBody([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0x90, 60, 100})), ErrVarLenTooLong},
+		{"text past the track", midiFile(96, trackBody([]byte{0x00, 0xFF, 0x01, 0xFF, 0xFF, 0xFF, 0x7F})), ErrChunkLength},
+		{"sysex past the track", midiFile(96, trackBody([]byte{0x00, 0xF0, 0x20, 0x01})), ErrChunkLength},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(bytes.NewReader(test.data))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, test.err)
+			}
+			var parseErr *ParseError
+			if err != nil && !errors.As(err, &parseErr) {
+				t.Errorf("Parse() error %T is not a *ParseError", err)
+			}
+		})
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	var note = []byte{0x00, 0x90, 60, 100, 0x60, 0x80, 60, 0}
+	var secondTrack = trackBody([]byte{0x00, 0x91, 64, 90, 0x30, 0x81, 64, 0})
+
+	var tests = []struct {
+		name string
+		// broken follows a note in the first track.
+		broken []byte
+		err    error
+	}{
+		{"varlen too long", []byte{0x00, 0xFF, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}, ErrVarLenTooLong},
+		{"length past the data", []byte{0x00, 0xFF, 0x01, 0xFF, 0xFF, 0xFF, 0x7F}, ErrChunkLength},
+		{"unknown status", []byte{0x00, 0xF4}, ErrUnknownStatus},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data = midiFile(96, trackBody(note, test.broken), secondTrack)
+			midi, err := ParseWithOptions(bytes.NewReader(data), Options{Lenient: true})
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			if len(midi.Warnings) != 1 || !errors.Is(midi.Warnings[0], test.err) {
+				t.Fatalf("Warnings = %v, want one %v", midi.Warnings, test.err)
+			}
+			if len(midi.Tracks) != 2 || len(midi.Tracks[0].Events) != 1 || len(midi.Tracks[1].Events) != 1 {
+				t.Fatalf("got tracks %+v, want the note before the damage and the second track", midi.Tracks)
+			}
+			if event := midi.Tracks[1].Events[0]; event.Note != 64 || event.Channel != 1 || event.Offtick != 0x30 {
+				t.Errorf("second track note = %+v", event)
+			}
+
+			encoded, err := json.Marshal(midi)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var decoded struct {
+				Warnings []struct {
+					Track   int    `json:"track"`
+					Message string `json:"message"`
+				} `json:"warnings"`
+			}
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded.Warnings) != 1 || decoded.Warnings[0].Message != midi.Warnings[0].Err.Error() {
+				t.Errorf("JSON warnings = %+v", decoded.Warnings)
+			}
+		})
+	}
+}
+
+func TestParseLenientChunks(t *testing.T) {
+	var tracks = [][]byte{
+		trackBody([]byte{0x00, 0x90, 60, 100, 0x60, 0x80, 60, 0}),
+		trackBody([]byte{0x00, 0x91, 64, 90, 0x30, 0x81, 64, 0}),
+		trackBody([]byte{0x00, 0x92, 67, 80, 0x10, 0x82, 67, 0}),
+	}
+	var junk = []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	// withJunk builds the file of the tracks with junk before the chunks
+	// of the given tracks, len(tracks) standing for the end of the file.
+	var withJunk = func(before ...int) []byte {
+		var chunks = midiFile(96, tracks...)
+		var data = bytes.Clone(chunks[:14])
+		var pos = 14
+		for i, body := range tracks {
+			if slices.Contains(before, i) {
+				data = append(data, junk...)
+			}
+			data = append(data, chunks[pos:pos+8+len(body)]...)
+			pos += 8 + len(body)
+		}
+		if slices.Contains(before, len(tracks)) {
+			data = append(data, junk...)
+		}
+		return data
+	}
+	var withoutLastTrack = bytes.Clone(withJunk(len(tracks)))
+	withoutLastTrack = append(withoutLastTrack[:len(withoutLastTrack)-len(junk)-8-len(tracks[2])], junk...)
+
+	var tests = []struct {
+		name     string
+		data     []byte
+		notes    []int
+		warnings []error
+	}{
+		{"junk before a track", withJunk(2), []int{60, 64, 67}, []error{ErrSkippedData}},
+		{"junk before the first track", withJunk(0), []int{60, 64, 67}, []error{ErrSkippedData}},
+		{"junk before two tracks", withJunk(1, 2), []int{60, 64, 67}, []error{ErrSkippedData, ErrSkippedData}},
+		{"junk after the tracks", withJunk(len(tracks)), []int{60, 64, 67}, nil},
+		{"junk instead of the last track", withoutLastTrack, []int{60, 64, -1}, []error{ErrSkippedData, ErrUnexpectedEOF}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			midi, err := ParseWithOptions(bytes.NewReader(test.data), Options{Lenient: true})
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			if len(midi.Warnings) != len(test.warnings) {
+				t.Fatalf("Warnings = %v, want %v", midi.Warnings, test.warnings)
+			}
+			for i, warning := range midi.Warnings {
+				if !errors.Is(warning, test.warnings[i]) {
+					t.Errorf("Warnings[%d] = %v, want %v", i, warning, test.warnings[i])
+				}
+			}
+			var notes = []int{}
+			for _, track := range midi.Tracks {
+				var note = -1
+				if len(track.Events) > 0 {
+					note = track.Events[0].Note
+				}
+				notes = append(notes, note)
+			}
+			if !reflect.DeepEqual(notes, test.notes) {
+				t.Errorf("first note of each track = %v, want %v", notes, test.notes)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package midiparser
+
+// NoteMatching decides which open note a note off closes when the same key
+// is held more than once on a channel.
+type NoteMatching int
+
+const (
+	// MatchFIFO closes the oldest open note first.
+	MatchFIFO NoteMatching = iota
+	// MatchLIFO closes the most recently started note first.
+	MatchLIFO
+)
+
+type noteKey struct {
+	channel byte
+	key     byte
+}
+
+// noteOn starts a note in the current track and remembers it as open.
+func (p *parser) noteOn(channel, key, velocity byte) {
+	track := p.track()
+	track.Events = append(track.Events, Event{Note: int(key), OnTick: track.Time, Channel: channel, Velocity: int(velocity)})
+
+	k := noteKey{channel, key}
+	p.openNotes[k] = append(p.openNotes[k], len(track.Events)-1)
+}
+
+// noteOff closes one open note of the same channel and key. Note offs
+// without a matching note on are ignored.
+func (p *parser) noteOff(channel, key, releaseVelocity byte) {
+	k := noteKey{channel, key}
+	open := p.openNotes[k]
+	if len(open) == 0 {
+		return
+	}
+
+	var index int
+	if p.options.NoteMatching == MatchLIFO {
+		index = open[len(open)-1]
+		open = open[:len(open)-1]
+	} else {
+		index = open[0]
+		open = open[1:]
+	}
+	if len(open) == 0 {
+		delete(p.openNotes, k)
+	} else {
+		p.openNotes[k] = open
+	}
+
+	track := p.track()
+	track.Events[index].Offtick = track.Time
+	track.Events[index].ReleaseVelocity = int(releaseVelocity)
+}
+
+// closeOpenNotes ends every note still held at the current track time.
+func (p *parser) closeOpenNotes() {
+	track := p.track()
+	for k, open := range p.openNotes {
+		for _, index := range open {
+			track.Events[index].Offtick = track.Time
+		}
+		delete(p.openNotes, k)
+	}
+}
@@ -0,0 +1,79 @@
+package midiparser
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNotePairing(t *testing.T) {
+	// noteSpan is what the test checks of an Event.
+	type noteSpan struct {
+		note, channel, on, off, velocity, releaseVelocity int
+	}
+
+	var tests = []struct {
+		name     string
+		events   []byte
+		matching NoteMatching
+		want     []noteSpan
+	}{
+		{
+			name:   "separate keys",
+			events: []byte{0x00, 0x90, 60, 100, 0x00, 0x90, 64, 90, 0x10, 0x80, 60, 40, 0x10, 0x80, 64, 30},
+			want:   []noteSpan{{60, 0, 0, 16, 100, 40}, {64, 0, 0, 32, 90, 30}},
+		},
+		{
+			name:   "zero velocity note on ends a note",
+			events: []byte{0x00, 0x90, 60, 100, 0x20, 0x90, 60, 0},
+			want:   []noteSpan{{60, 0, 0, 32, 100, 64}},
+		},
+		{
+			name:   "running status",
+			events: []byte{0x00, 0x90, 60, 100, 0x10, 60, 0, 0x00, 62, 80, 0x10, 62, 0},
+			want:   []noteSpan{{60, 0, 0, 16, 100, 64}, {62, 0, 16, 32, 80, 64}},
+		},
+		{
+			name:   "overlapping same key first in first out",
+			events: []byte{0x00, 0x90, 60, 100, 0x10, 0x90, 60, 50, 0x10, 0x80, 60, 0, 0x10, 0x80, 60, 0},
+			want:   []noteSpan{{60, 0, 0, 32, 100, 0}, {60, 0, 16, 48, 50, 0}},
+		},
+		{
+			name:     "overlapping same key last in first out",
+			events:   []byte{0x00, 0x90, 60, 100, 0x10, 0x90, 60, 50, 0x10, 0x80, 60, 0, 0x10, 0x80, 60, 0},
+			matching: MatchLIFO,
+			want:     []noteSpan{{60, 0, 0, 48, 100, 0}, {60, 0, 16, 32, 50, 0}},
+		},
+		{
+			name:   "channels are paired apart",
+			events: []byte{0x00, 0x90, 60, 100, 0x00, 0x91, 60, 90, 0x10, 0x81, 60, 0, 0x10, 0x80, 60, 0},
+			want:   []noteSpan{{60, 0, 0, 32, 100, 0}, {60, 1, 0, 16, 90, 0}},
+		},
+		{
+			name:   "note off without note on is ignored",
+			events: []byte{0x00, 0x80, 61, 0, 0x00, 0x90, 60, 100, 0x10, 0x80, 60, 0},
+			want:   []noteSpan{{60, 0, 0, 16, 100, 0}},
+		},
+		{
+			name:   "open notes end with the track",
+			events: []byte{0x00, 0x90, 60, 100, 0x30, 0xFF, 0x01, 0x00},
+			want:   []noteSpan{{60, 0, 0, 48, 100, 0}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data = midiFile(96, trackBody(test.events))
+			midi, err := ParseWithOptions(bytes.NewReader(data), Options{NoteMatching: test.matching})
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			var got = []noteSpan{}
+			for _, event := range midi.Tracks[0].Events {
+				got = append(got, noteSpan{event.Note, int(event.Channel), event.OnTick, event.Offtick, event.Velocity, event.ReleaseVelocity})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("notes = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package midiparser
+
+// PercussionChannel is General MIDI channel 10, counted from zero.
+const PercussionChannel byte = 9
+
+// PercussionFamily is the instrument family of percussion channel notes.
+const PercussionFamily = "Drums"
+
+func IsPercussionChannel(channel byte) bool {
+	return channel == PercussionChannel
+}
+
+// PercussionName returns the General MIDI drum sound a note triggers on the
+// percussion channel, or "" for notes outside the map.
+func PercussionName(note int) string {
+	return percussionTable[note]
+}
@@ -0,0 +1,81 @@
+package midiparser
+
+import "sort"
+
+func (p *parser) programChange(channel, patch byte) {
+	instrument := instrumentsTable[int(patch)]
+	p.channels[channel] = Channel{Name: p.channels[channel].Name, Instrument: instrument, Patch: patch}
+	p.programChanges[channel] = append(p.programChanges[channel], ProgramChange{
+		Patch:      patch,
+		Instrument: instrument,
+		OnTick:     p.track().Time,
+		Channel:    channel,
+		Track:      p.trackIndex,
+	})
+}
+
+func (p *parser) pitchBend(channel byte, value int) {
+	p.pitchBends[channel] = append(p.pitchBends[channel], PitchBend{
+		Value:   value,
+		OnTick:  p.track().Time,
+		Channel: channel,
+		Track:   p.trackIndex,
+	})
+}
+
+// sortChannelTimelines merges the program and pitch bend timelines collected
+// from every track.
+func (p *parser) sortChannelTimelines() {
+	for _, changes := range p.programChanges {
+		sort.SliceStable(changes, func(i, j int) bool {
+			return changes[i].OnTick < changes[j].OnTick
+		})
+	}
+	for _, bends := range p.pitchBends {
+		sort.SliceStable(bends, func(i, j int) bool {
+			return bends[i].OnTick < bends[j].OnTick
+		})
+	}
+}
+
+// ProgramAt returns the program a channel plays at tick. Channels start on
+// the General MIDI default, patch 0.
+func (m ParsedMidi) ProgramAt(channel byte, tick int) ProgramChange {
+	changes := m.ProgramChanges[channel]
+	i := sort.Search(len(changes), func(i int) bool {
+		return changes[i].OnTick > tick
+	})
+	if i == 0 {
+		return ProgramChange{Instrument: instrumentsTable[0], Channel: channel}
+	}
+	return changes[i-1]
+}
+
+// PitchBendAt returns the pitch bend of a channel at tick.
+func (m ParsedMidi) PitchBendAt(channel byte, tick int) int {
+	bends := m.PitchBends[channel]
+	i := sort.Search(len(bends), func(i int) bool {
+		return bends[i].OnTick > tick
+	})
+	if i == 0 {
+		return 0
+	}
+	return bends[i-1].Value
+}
+
+// InstrumentName returns the General MIDI name of a patch.
+func InstrumentName(patch byte) string {
+	if int(patch) >= len(instrumentsTable) {
+		return ""
+	}
+	return instrumentsTable[patch]
+}
+
+// InstrumentFamily returns the General MIDI family of a patch, e.g. "Piano"
+// or "Strings".
+func InstrumentFamily(patch byte) string {
+	if int(patch)/8 >= len(instrumentFamiliesTable) {
+		return ""
+	}
+	return instrumentFamiliesTable[patch/8]
+}
@@ -0,0 +1,111 @@
+package midiparser
+
+import (
+	"fmt"
+	"sort"
+)
+
+var defaultTimeSignature = TimeSignature{Numerator: 4, Denominator: 4, ClocksPerClick: 24, ThirtySecondsPerQuarter: 8}
+
+func (m *HeaderMeta) sortSignatures() {
+	sort.SliceStable(m.TimeSignatures, func(i, j int) bool {
+		return m.TimeSignatures[i].OnTick < m.TimeSignatures[j].OnTick
+	})
+	sort.SliceStable(m.KeySignatures, func(i, j int) bool {
+		return m.KeySignatures[i].OnTick < m.KeySignatures[j].OnTick
+	})
+}
+
+// IsSMPTE reports whether ticks count SMPTE frame subdivisions rather than
+// fractions of a quarter note. Tempo changes don't affect SMPTE timing.
+func (m HeaderMeta) IsSMPTE() bool {
+	return m.SMPTEFramesPerSecond > 0
+}
+
+// SMPTETicksPerSecond returns the fixed tick rate of SMPTE timed files.
+func (m HeaderMeta) SMPTETicksPerSecond() float64 {
+	return m.SMPTEFramesPerSecond * float64(m.TicksPerFrame)
+}
+
+// TimeSignatureAt returns the time signature in effect at tick, 4/4 if the
+// file sets none before it.
+func (m HeaderMeta) TimeSignatureAt(tick int) TimeSignature {
+	var current = defaultTimeSignature
+	for _, ts := range m.TimeSignatures {
+		if ts.OnTick > tick {
+			break
+		}
+		current = ts
+	}
+	return current
+}
+
+// KeySignatureAt returns the key signature in effect at tick, C major if the
+// file sets none before it.
+func (m HeaderMeta) KeySignatureAt(tick int) KeySignature {
+	var current = KeySignature{}
+	for _, ks := range m.KeySignatures {
+		if ks.OnTick > tick {
+			break
+		}
+		current = ks
+	}
+	return current
+}
+
+// TicksPerBar returns the length of one measure of ts, 0 if ts has no
+// denominator.
+func (m HeaderMeta) TicksPerBar(ts TimeSignature) int {
+	if ts.Denominator <= 0 {
+		return 0
+	}
+	return m.QuarterValue * 4 * ts.Numerator / ts.Denominator
+}
+
+// Bars returns the tick at which every measure up to lastTick starts,
+// following time signature changes.
+func (m HeaderMeta) Bars(lastTick int) []int {
+	var bars = []int{}
+	if m.QuarterValue <= 0 {
+		return bars
+	}
+	for tick := 0; tick <= lastTick; {
+		bars = append(bars, tick)
+		var ts = m.TimeSignatureAt(tick)
+		var next = tick + m.TicksPerBar(ts)
+		// A signature change inside a measure starts a new one.
+		for _, change := range m.TimeSignatures {
+			if change.OnTick > tick && change.OnTick < next {
+				next = change.OnTick
+				break
+			}
+		}
+		if next <= tick {
+			break
+		}
+		tick = next
+	}
+	return bars
+}
+
+// Name returns the key's name, e.g. "Eb major" or "F# minor".
+func (ks KeySignature) Name() string {
+	var index = ks.Sharps + 7
+	if index < 0 || index >= len(majorKeyNames) {
+		return ""
+	}
+	if ks.Minor {
+		return minorKeyNames[index] + " minor"
+	}
+	return majorKeyNames[index] + " major"
+}
+
+// NoteName spells a MIDI note number in the key, using flats in flat keys
+// and sharps otherwise, with middle C as C4.
+func (ks KeySignature) NoteName(note int) string {
+	var names = sharpNoteNames
+	if ks.Sharps < 0 {
+		names = flatNoteNames
+	}
+	return fmt.Sprintf("%s%d", names[note%12], note/12-1)
+}
@@ -0,0 +1,64 @@
+package midiparser
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTimeSignatures(t *testing.T) {
+	var timeSignature = func(delta, numerator, exponent byte) []byte {
+		return []byte{delta, 0xFF, 0x58, 0x04, numerator, exponent, 24, 8}
+	}
+
+	var tests = []struct {
+		name    string
+		events  []byte
+		lenient bool
+		err     error
+		// bars follow a note of 896 ticks after the events.
+		bars []int
+	}{
+		{"default 4/4", nil, false, nil, []int{0, 384, 768}},
+		{"3/4", timeSignature(0, 3, 2), false, nil, []int{0, 288, 576, 864}},
+		// The second delta is 0x83 0x00, 384 ticks.
+		{"6/8 after a bar", bytes.Join([][]byte{timeSignature(0, 4, 2), {0x83}, timeSignature(0, 6, 3)}, nil), false, nil, []int{0, 384, 672, 960, 1248}},
+		{"exponent 64", timeSignature(0, 4, 64), false, ErrTimeSignature, nil},
+		{"zero numerator", timeSignature(0, 0, 2), false, ErrTimeSignature, nil},
+		{"exponent 64 lenient", timeSignature(0, 4, 64), true, nil, []int{0, 384, 768}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data = midiFile(96, trackBody(test.events, []byte{0x00, 0x90, 60, 100, 0x87, 0x00, 0x80, 60, 0}))
+			midi, err := ParseWithOptions(bytes.NewReader(data), Options{Lenient: test.lenient})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ParseWithOptions() error = %v, want %v", err, test.err)
+			}
+			if err != nil || test.bars == nil {
+				return
+			}
+			if got := midi.Meta.Bars(midi.LastTick()); !reflect.DeepEqual(got, test.bars) {
+				t.Errorf("Bars() = %v, want %v", got, test.bars)
+			}
+		})
+	}
+}
+
+func TestTicksPerBar(t *testing.T) {
+	var meta = HeaderMeta{QuarterValue: 96}
+	var tests = []struct {
+		ts   TimeSignature
+		want int
+	}{
+		{TimeSignature{Numerator: 4, Denominator: 4}, 384},
+		{TimeSignature{Numerator: 6, Denominator: 8}, 288},
+		{TimeSignature{Numerator: 2, Denominator: 2}, 384},
+		{TimeSignature{Numerator: 4, Denominator: 0}, 0},
+	}
+	for _, test := range tests {
+		if got := meta.TicksPerBar(test.ts); got != test.want {
+			t.Errorf("TicksPerBar(%d/%d) = %d, want %d", test.ts.Numerator, test.ts.Denominator, got, test.want)
+		}
+	}
+}
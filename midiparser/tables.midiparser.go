@@ -130,3 +130,83 @@ var instrumentsTable = []string{
 	"Applause",
 	"Gunshot",
 }
+
+var smpteFrameRates = []float64{24, 25, 29.97, 30}
+
+var sharpNoteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+var flatNoteNames = []string{"C", "Db", "D", "Eb", "E", "F", "Gb", "G", "Ab", "A", "Bb", "B"}
+
+// Key names indexed by the number of sharps plus 7, from 7 flats to 7 sharps.
+var majorKeyNames = []string{"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#"}
+var minorKeyNames = []string{"Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#", "G#", "D#", "A#"}
+
+// General MIDI percussion key map, notes 35 to 81 on the percussion channel.
+var percussionTable = map[int]string{
+	35: "Acoustic Bass Drum",
+	36: "Bass Drum 1",
+	37: "Side Stick",
+	38: "Acoustic Snare",
+	39: "Hand Clap",
+	40: "Electric Snare",
+	41: "Low Floor Tom",
+	42: "Closed Hi-Hat",
+	43: "High Floor Tom",
+	44: "Pedal Hi-Hat",
+	45: "Low Tom",
+	46: "Open Hi-Hat",
+	47: "Low-Mid Tom",
+	48: "Hi-Mid Tom",
+	49: "Crash Cymbal 1",
+	50: "High Tom",
+	51: "Ride Cymbal 1",
+	52: "Chinese Cymbal",
+	53: "Ride Bell",
+	54: "Tambourine",
+	55: "Splash Cymbal",
+	56: "Cowbell",
+	57: "Crash Cymbal 2",
+	58: "Vibraslap",
+	59: "Ride Cymbal 2",
+	60: "Hi Bongo",
+	61: "Low Bongo",
+	62: "Mute Hi Conga",
+	63: "Open Hi Conga",
+	64: "Low Conga",
+	65: "High Timbale",
+	66: "Low Timbale",
+	67: "High Agogo",
+	68: "Low Agogo",
+	69: "Cabasa",
+	70: "Maracas",
+	71: "Short Whistle",
+	72: "Long Whistle",
+	73: "Short Guiro",
+	74: "Long Guiro",
+	75: "Claves",
+	76: "Hi Wood Block",
+	77: "Low Wood Block",
+	78: "Mute Cuica",
+	79: "Open Cuica",
+	80: "Mute Triangle",
+	81: "Open Triangle",
+}
+
+// General MIDI instrument families, one for every 8 patches.
+var instrumentFamiliesTable = []string{
+	"Piano",
+	"Chromatic Percussion",
+	"Organ",
+	"Guitar",
+	"Bass",
+	"Strings",
+	"Ensemble",
+	"Brass",
+	"Reed",
+	"Pipe",
+	"Synth Lead",
+	"Synth Pad",
+	"Synth Effects",
+	"Ethnic",
+	"Percussive",
+	"Sound Effects",
+}
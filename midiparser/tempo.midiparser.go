@@ -0,0 +1,114 @@
+package midiparser
+
+import (
+	"sort"
+)
+
+// defaultBpm is the tempo until a file's first tempo change.
+const defaultBpm = 120
+
+// TempoMap converts between ticks and seconds from the start of a file,
+// following its tempo changes.
+type TempoMap struct {
+	// smpteTicksPerSecond is the fixed tick rate of SMPTE timed files,
+	// which ignore tempo changes.
+	smpteTicksPerSecond float64
+	changes             []tempoChange
+}
+
+// tempoChange is a tempo from its tick on, with the time it starts at.
+type tempoChange struct {
+	tick           int
+	seconds        float64
+	secondsPerTick float64
+	bpm            float64
+}
+
+// TempoMap returns the tempo map of the file. Ticks before its first tempo
+// change play at 120 bpm, and of several changes on one tick the last one
+// read holds. SMPTE headers without a tick rate fall back to the tempos.
+func (m HeaderMeta) TempoMap() *TempoMap {
+	if m.IsSMPTE() && m.SMPTETicksPerSecond() > 0 {
+		return &TempoMap{smpteTicksPerSecond: m.SMPTETicksPerSecond()}
+	}
+
+	var tempos = append([]Tempo{{Bpm: defaultBpm}}, m.Tempos...)
+	sort.SliceStable(tempos, func(i, j int) bool {
+		return tempos[i].OnTick < tempos[j].OnTick
+	})
+	var quarterValue = float64(max(m.QuarterValue, 1))
+
+	var t = &TempoMap{}
+	for _, tempo := range tempos {
+		if tempo.Bpm <= 0 {
+			continue
+		}
+		var change = tempoChange{
+			tick:           tempo.OnTick,
+			secondsPerTick: 60 / tempo.Bpm / quarterValue,
+			bpm:            tempo.Bpm,
+		}
+		if n := len(t.changes); n > 0 {
+			var previous = t.changes[n-1]
+			change.seconds = previous.seconds + float64(change.tick-previous.tick)*previous.secondsPerTick
+			if previous.tick == change.tick {
+				t.changes = t.changes[:n-1]
+			}
+		}
+		t.changes = append(t.changes, change)
+	}
+	return t
+}
+
+// changeAt returns the tempo change in effect at tick.
+func (t *TempoMap) changeAt(tick float64) tempoChange {
+	var i = sort.Search(len(t.changes), func(i int) bool {
+		return float64(t.changes[i].tick) > tick
+	})
+	return t.changeBefore(i)
+}
+
+// changeBefore returns the tempo change before the i-th, or the first one.
+// A map without changes, such as the zero TempoMap, plays at 120 bpm with
+// a tick per quarter note.
+func (t *TempoMap) changeBefore(i int) tempoChange {
+	if len(t.changes) == 0 {
+		return tempoChange{secondsPerTick: 60.0 / defaultBpm, bpm: defaultBpm}
+	}
+	return t.changes[max(i-1, 0)]
+}
+
+// Seconds returns the time of tick.
+func (t *TempoMap) Seconds(tick int) float64 {
+	return t.SecondsAt(float64(tick))
+}
+
+// SecondsAt returns the time of a tick, which may fall between two.
+func (t *TempoMap) SecondsAt(tick float64) float64 {
+	if t.smpteTicksPerSecond > 0 {
+		return tick / t.smpteTicksPerSecond
+	}
+	var change = t.changeAt(tick)
+	return change.seconds + (tick-float64(change.tick))*change.secondsPerTick
+}
+
+// Tick returns the tick played at seconds, with the fraction of the tick
+// elapsed.
+func (t *TempoMap) Tick(seconds float64) float64 {
+	if t.smpteTicksPerSecond > 0 {
+		return seconds * t.smpteTicksPerSecond
+	}
+	var i = sort.Search(len(t.changes), func(i int) bool {
+		return t.changes[i].seconds > seconds
+	})
+	var change = t.changeBefore(i)
+	return float64(change.tick) + (seconds-change.seconds)/change.secondsPerTick
+}
+
+// BpmAt returns the tempo at tick, 0 for SMPTE timed files.
+func (t *TempoMap) BpmAt(tick int) float64 {
+	if t.smpteTicksPerSecond > 0 {
+		return 0
+	}
+	return t.changeAt(float64(tick)).bpm
+}
@@ -0,0 +1,77 @@
+package midiparser
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestTempoMap(t *testing.T) {
+	// 96 ticks per quarter at 120 bpm, then 60 bpm from tick 192 and 240
+	// bpm from tick 288, where the times are 1 s and 2 s.
+	var changes = HeaderMeta{
+		QuarterValue: 96,
+		Tempos:       []Tempo{{Bpm: 60, OnTick: 192}, {Bpm: 240, OnTick: 288}},
+	}
+	// Tempo events out of order, and two on one tick.
+	var unsorted = HeaderMeta{
+		QuarterValue: 96,
+		Tempos:       []Tempo{{Bpm: 240, OnTick: 288}, {Bpm: 90, OnTick: 192}, {Bpm: 60, OnTick: 192}},
+	}
+	var smpte = HeaderMeta{SMPTEFramesPerSecond: 25, TicksPerFrame: 40}
+
+	var tests = []struct {
+		name    string
+		meta    HeaderMeta
+		tick    int
+		seconds float64
+		bpm     float64
+	}{
+		{"no tempo events", HeaderMeta{QuarterValue: 96}, 96, 0.5, 120},
+		{"no division", HeaderMeta{}, 2, 1, 120},
+		{"before a change", changes, 96, 0.5, 120},
+		{"at a change", changes, 192, 1, 60},
+		{"after a change", changes, 240, 1.5, 60},
+		{"after two changes", changes, 384, 2.25, 240},
+		{"unsorted", unsorted, 384, 2.25, 240},
+		{"SMPTE", smpte, 500, 0.5, 0},
+		{"SMPTE without ticks per frame", HeaderMeta{SMPTEFramesPerSecond: 24, QuarterValue: 96}, 96, 0.5, 120},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tempoMap = test.meta.TempoMap()
+			if got := tempoMap.Seconds(test.tick); math.Abs(got-test.seconds) > 1e-9 {
+				t.Errorf("Seconds(%d) = %g, want %g", test.tick, got, test.seconds)
+			}
+			if got := tempoMap.Tick(test.seconds); math.Abs(got-float64(test.tick)) > 1e-6 {
+				t.Errorf("Tick(%g) = %g, want %d", test.seconds, got, test.tick)
+			}
+			if got := tempoMap.BpmAt(test.tick); got != test.bpm {
+				t.Errorf("BpmAt(%d) = %g, want %g", test.tick, got, test.bpm)
+			}
+		})
+	}
+}
+
+func TestZeroTempoMap(t *testing.T) {
+	var tempoMap = &TempoMap{}
+	if got := tempoMap.Seconds(2); got != 1 {
+		t.Errorf("Seconds(2) = %g, want 1", got)
+	}
+	if got := tempoMap.Tick(1); got != 2 {
+		t.Errorf("Tick(1) = %g, want 2", got)
+	}
+}
+
+func TestParsedTempoMap(t *testing.T) {
+	// A tempo of 60 bpm, 1000000 µs per quarter, from tick 96.
+	var tempo = []byte{0x60, 0xFF, 0x51, 0x03, 0x0F, 0x42, 0x40}
+	midi, err := Parse(bytes.NewReader(midiFile(96, trackBody(tempo))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tempoMap = midi.Meta.TempoMap()
+	if got := tempoMap.Seconds(192); got != 1.5 {
+		t.Errorf("Seconds(192) = %g, want 1.5", got)
+	}
+}
@@ -0,0 +1,108 @@
+package midiparser
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// TextType is the meta event type of a text event.
+type TextType byte
+
+const (
+	TextGeneric        TextType = 1
+	TextCopyright      TextType = 2
+	TextTrackName      TextType = 3
+	TextInstrumentName TextType = 4
+	TextLyric          TextType = 5
+	TextMarker         TextType = 6
+	TextCuePoint       TextType = 7
+	TextProgramName    TextType = 8
+	TextDeviceName     TextType = 9
+)
+
+// decodeText reads meta event text as UTF-8 when it is valid and as Latin-1
+// otherwise, which is what most older files use.
+func decodeText(bts []byte) string {
+	if utf8.Valid(bts) {
+		return string(bts)
+	}
+	return bytesToString(bts)
+}
+
+func (p *parser) addText(textType TextType, text string) {
+	track := p.track()
+	if textType == TextTrackName && track.Name == "" {
+		track.Name = strings.TrimSpace(text)
+	}
+	p.texts = append(p.texts, TextEvent{
+		Type:   textType,
+		Text:   text,
+		OnTick: track.Time,
+		Track:  p.trackIndex,
+	})
+}
+
+func (p *parser) sortTexts() {
+	sort.SliceStable(p.texts, func(i, j int) bool {
+		return p.texts[i].OnTick < p.texts[j].OnTick
+	})
+}
+
+// nameChannels gives every channel the name of the first track playing
+// notes on it. Channels without a program change get the General MIDI
+// default patch.
+func (p *parser) nameChannels() {
+	for _, track := range p.tracks {
+		if track.Name == "" {
+			continue
+		}
+		for _, event := range track.Events {
+			channel, exists := p.channels[event.Channel]
+			if !exists {
+				channel = Channel{Instrument: instrumentsTable[0]}
+			}
+			if channel.Name == "" {
+				channel.Name = track.Name
+				p.channels[event.Channel] = channel
+			}
+		}
+	}
+}
+
+// TextsOfType returns the text events of one type in tick order.
+func (m ParsedMidi) TextsOfType(textType TextType) []TextEvent {
+	var texts = []TextEvent{}
+	for _, text := range m.Texts {
+		if text.Type == textType {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+func (m ParsedMidi) Lyrics() []TextEvent {
+	return m.TextsOfType(TextLyric)
+}
+
+func (m ParsedMidi) Markers() []TextEvent {
+	return m.TextsOfType(TextMarker)
+}
+
+func (m ParsedMidi) CuePoints() []TextEvent {
+	return m.TextsOfType(TextCuePoint)
+}
+
+// Title returns the sequence name, the track name of the first track, or
+// the first track name found when that one has none.
+func (m ParsedMidi) Title() string {
+	if len(m.Tracks) > 0 && m.Tracks[0].Name != "" {
+		return m.Tracks[0].Name
+	}
+	for _, track := range m.Tracks {
+		if track.Name != "" {
+			return track.Name
+		}
+	}
+	return ""
+}
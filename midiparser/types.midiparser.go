@@ -1,10 +1,12 @@
 package midiparser
 
 type Event struct {
-	Note    int  `json:"note"`
-	OnTick  int  `json:"on_tick"`
-	Offtick int  `json:"off_tick"`
-	Channel byte `json:"channel"`
+	Note            int  `json:"note"`
+	OnTick          int  `json:"on_tick"`
+	Offtick         int  `json:"off_tick"`
+	Channel         byte `json:"channel"`
+	Velocity        int  `json:"velocity"`
+	ReleaseVelocity int  `json:"release_velocity"`
 }
 
 type Channel struct {
@@ -14,6 +16,7 @@ type Channel struct {
 }
 
 type Track struct {
+	Name   string
 	Events []Event
 	Time   int
 }
@@ -22,14 +25,100 @@ type Tempo struct {
 	Bpm    float64 `json:"bpm"`
 	OnTick int     `json:"on_tick"`
 }
+
+type TimeSignature struct {
+	Numerator               int `json:"numerator"`
+	Denominator             int `json:"denominator"`
+	ClocksPerClick          int `json:"clocks_per_click"`
+	ThirtySecondsPerQuarter int `json:"thirty_seconds_per_quarter"`
+	OnTick                  int `json:"on_tick"`
+}
+
+// KeySignature counts sharps as positive and flats as negative numbers.
+type KeySignature struct {
+	Sharps int  `json:"sharps"`
+	Minor  bool `json:"minor"`
+	OnTick int  `json:"on_tick"`
+}
+
+type SMPTEOffset struct {
+	FrameRate float64 `json:"frame_rate"`
+	Hours     int     `json:"hours"`
+	Minutes   int     `json:"minutes"`
+	Seconds   int     `json:"seconds"`
+	Frames    int     `json:"frames"`
+	SubFrames int     `json:"sub_frames"`
+}
+
+// HeaderMeta describes the file's timing. QuarterValue is the number of
+// ticks per quarter note; it is 0 for SMPTE timed files, which count
+// TicksPerFrame ticks in each of SMPTEFramesPerSecond frames instead.
 type HeaderMeta struct {
-	QuarterValue int     `json:"quarterValue"`
-	TracksNumber int     `json:"tracksNumber"`
-	Tempos       []Tempo `json:"tempos"`
+	QuarterValue         int     `json:"quarterValue"`
+	SMPTEFramesPerSecond float64 `json:"smpteFramesPerSecond,omitempty"`
+	TicksPerFrame        int     `json:"ticksPerFrame,omitempty"`
+
+	TracksNumber   int             `json:"tracksNumber"`
+	Tempos         []Tempo         `json:"tempos"`
+	TimeSignatures []TimeSignature `json:"timeSignatures"`
+	KeySignatures  []KeySignature  `json:"keySignatures"`
+	SMPTEOffset    *SMPTEOffset    `json:"smpteOffset,omitempty"`
+}
+
+type ControlChange struct {
+	Controller byte `json:"controller"`
+	Value      byte `json:"value"`
+	OnTick     int  `json:"on_tick"`
+	Channel    byte `json:"channel"`
+	Track      int  `json:"track"`
+}
+
+type ProgramChange struct {
+	Patch      byte   `json:"patch"`
+	Instrument string `json:"instrument"`
+	OnTick     int    `json:"on_tick"`
+	Channel    byte   `json:"channel"`
+	Track      int    `json:"track"`
+}
+
+// PitchBend values range from -8192 to 8191, 0 being no bend.
+type PitchBend struct {
+	Value   int  `json:"value"`
+	OnTick  int  `json:"on_tick"`
+	Channel byte `json:"channel"`
+	Track   int  `json:"track"`
+}
+
+type TextEvent struct {
+	Type   TextType `json:"type"`
+	Text   string   `json:"text"`
+	OnTick int      `json:"on_tick"`
+	Track  int      `json:"track"`
 }
 
 type ParsedMidi struct {
 	Tracks   []Track          `json:"tracks"`
 	Channels map[byte]Channel `json:"channels"`
-	Meta     HeaderMeta       `json:"meta"`
+	// ControlChanges holds the tick ordered controller timeline per channel
+	// and controller number.
+	ControlChanges map[byte]map[byte][]ControlChange `json:"control_changes"`
+	// ProgramChanges and PitchBends hold the tick ordered patch and pitch
+	// bend timelines per channel.
+	ProgramChanges map[byte][]ProgramChange `json:"program_changes"`
+	PitchBends     map[byte][]PitchBend     `json:"pitch_bends"`
+	// Texts holds the text, lyric, marker and name meta events of every
+	// track in tick order.
+	Texts    []TextEvent   `json:"texts"`
+	Meta     HeaderMeta    `json:"meta"`
+	Warnings []*ParseError `json:"warnings,omitempty"`
+}
+
+type Options struct {
+	// Lenient skips unknown meta events, resynchronises on the next MTrk
+	// header after a damaged track and closes notes left open, reporting
+	// each repair in ParsedMidi.Warnings. Strict parsing is the default.
+	Lenient bool
+	// NoteMatching pairs note offs with overlapping notes of the same key
+	// and channel, oldest first by default.
+	NoteMatching NoteMatching
 }
@@ -0,0 +1,217 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"piano-video/videogenerator"
+)
+
+const maxFPS = 240
+const maxCRF = 51
+
+// validator collects the problems of a project instead of stopping at the
+// first one.
+type validator struct {
+	problems []*FieldError
+}
+
+func (v *validator) add(field string, err error) {
+	v.problems = append(v.problems, &FieldError{Field: field, Err: err})
+}
+
+func (v *validator) addf(field string, format string, args ...any) {
+	v.add(field, fmt.Errorf(format, args...))
+}
+
+func (v *validator) checkFile(field string, path string) {
+	if path == "" {
+		return
+	}
+	if info, err := os.Stat(path); err != nil {
+		v.add(field, err)
+	} else if info.IsDir() {
+		v.addf(field, "%s is a folder", path)
+	}
+}
+
+func (v *validator) tracks(field string, tracks []int) []int {
+	for i, track := range tracks {
+		if track < 0 {
+			v.addf(fmt.Sprintf("%s[%d]", field, i), "invalid track %d, tracks count from 0", track)
+		}
+	}
+	return tracks
+}
+
+// channels converts channels numbered 1 to 16 to the 0 to 15 numbers of the
+// MIDI messages.
+func (v *validator) channels(field string, channels []int) []byte {
+	var converted = []byte{}
+	for i, channel := range channels {
+		if channel < 1 || channel > 16 {
+			v.addf(fmt.Sprintf("%s[%d]", field, i), "invalid channel %d, want 1 to 16", channel)
+			continue
+		}
+		converted = append(converted, byte(channel-1))
+	}
+	return converted
+}
+
+func (v *validator) patches(field string, patches []int) []byte {
+	var converted = []byte{}
+	for i, patch := range patches {
+		if patch < 0 || patch > 127 {
+			v.addf(fmt.Sprintf("%s[%d]", field, i), "invalid patch %d, want 0 to 127", patch)
+			continue
+		}
+		converted = append(converted, byte(patch))
+	}
+	return converted
+}
+
+func (v *validator) selection(field string, s *Selection, selection *videogenerator.Selection) {
+	if s == nil {
+		return
+	}
+	*selection = videogenerator.Selection{
+		IncludeTracks:     v.tracks(field+".includeTracks", s.IncludeTracks),
+		ExcludeTracks:     v.tracks(field+".excludeTracks", s.ExcludeTracks),
+		IncludeTrackNames: s.IncludeTrackNames,
+		ExcludeTrackNames: s.ExcludeTrackNames,
+		IncludeChannels:   v.channels(field+".includeChannels", s.IncludeChannels),
+		ExcludeChannels:   v.channels(field+".excludeChannels", s.ExcludeChannels),
+		IncludePatches:    v.patches(field+".includePatches", s.IncludePatches),
+		ExcludePatches:    v.patches(field+".excludePatches", s.ExcludePatches),
+		IncludeFamilies:   s.IncludeFamilies,
+		ExcludeFamilies:   s.ExcludeFamilies,
+	}
+}
+
+func setBool(value *bool, setting *bool) {
+	if value != nil {
+		*setting = *value
+	}
+}
+
+// Config returns the render settings of the project, checking all of them.
+// Errors are of type *Error and list every invalid setting.
+func (p *Project) Config() (videogenerator.Config, error) {
+	var config = videogenerator.DefaultConfig()
+	var v = &validator{}
+	var err error
+
+	v.checkFile("input", p.InputPath())
+	v.checkFile("audio", p.resolvePath(p.Audio))
+	config.AudioFilePath = p.resolvePath(p.Audio)
+	if p.Synth != "" || p.SoundFont != "" {
+		var synth = p.Synth
+		if synth == "" {
+			synth = "builtin"
+		}
+		v.checkFile("soundFont", p.resolvePath(p.SoundFont))
+		if config.AudioRenderer, err = videogenerator.ParseSynth(synth, p.resolvePath(p.SoundFont)); err != nil {
+			v.add("synth", err)
+		}
+	}
+
+	if p.Theme != "" {
+		var theme, found = videogenerator.ThemeByName(p.Theme)
+		if !found {
+			v.addf("theme", "unknown theme %q", p.Theme)
+		}
+		config.Theme = theme
+	}
+	if len(p.Colors) > 0 {
+		config.Theme.Colors = []videogenerator.Color{}
+		for i, value := range p.Colors {
+			color, err := videogenerator.ParseColor(value)
+			if err != nil {
+				v.add(fmt.Sprintf("colors[%d]", i), err)
+			}
+			config.Theme.Colors = append(config.Theme.Colors, color)
+		}
+	}
+	if p.ColorBy != "" {
+		if config.ColorNotesBy, err = videogenerator.ParseColorMode(p.ColorBy); err != nil {
+			v.add("colorBy", err)
+		}
+	}
+
+	if p.Resolution != "" {
+		if config.Resolution, err = videogenerator.ParseResolution(p.Resolution); err != nil {
+			v.add("resolution", err)
+		}
+	}
+	if p.FPS < 0 || p.FPS > maxFPS {
+		v.addf("fps", "invalid fps %d, want 1 to %d", p.FPS, maxFPS)
+	} else if p.FPS > 0 {
+		config.FPS = p.FPS
+	}
+	if p.Keyboard != "" {
+		if config.LowestNote, config.HighestNote, err = videogenerator.ParseKeyboard(string(p.Keyboard)); err != nil {
+			v.add("keyboard", err)
+		}
+	}
+	if p.LeadIn != nil {
+		if *p.LeadIn < 0 {
+			v.addf("leadIn", "invalid lead-in %g, want 0 or more seconds", *p.LeadIn)
+		}
+		config.StartDelaySec = *p.LeadIn
+	}
+	if p.Workers < 0 {
+		v.addf("workers", "invalid workers %d", p.Workers)
+	} else if p.Workers > 0 {
+		config.Workers = p.Workers
+	}
+
+	if p.TitleCard != nil {
+		if p.TitleCard.Duration < 0 {
+			v.addf("titleCard.duration", "invalid duration %g, want 0 or more seconds", p.TitleCard.Duration)
+		}
+		config.TitleCard = videogenerator.TitleCard{
+			Title:    p.TitleCard.Title,
+			Subtitle: p.TitleCard.Subtitle,
+			Duration: p.TitleCard.Duration,
+		}
+	}
+
+	setBool(p.Overlays.VelocityShading, &config.VelocityShading)
+	setBool(p.Overlays.Pedals, &config.ShowPedalLane)
+	setBool(p.Overlays.SustainTails, &config.ShowSustainTails)
+	setBool(p.Overlays.Lyrics, &config.ShowLyrics)
+	setBool(p.Overlays.DrumStrip, &config.ShowDrumStrip)
+	setBool(p.Overlays.Chapters, &config.WriteChapters)
+	setBool(p.Overlays.Subtitles, &config.WriteSubtitles)
+
+	v.selection("tracks.draw", p.Tracks.Draw, &config.Selection.Draw)
+	v.selection("tracks.audio", p.Tracks.Audio, &config.Selection.Audio)
+	config.DrumChannels = v.channels("tracks.drumChannels", p.Tracks.DrumChannels)
+	setBool(p.Tracks.DrumsOnKeyboard, &config.DrumsOnKeyboard)
+
+	var output = p.Output
+	var encoding = &config.Encoding
+	for _, setting := range []struct {
+		value string
+		field *string
+	}{
+		{output.VideoCodec, &encoding.VideoCodec},
+		{output.Preset, &encoding.Preset},
+		{output.Tune, &encoding.Tune},
+		{output.PixelFormat, &encoding.PixelFormat},
+		{output.AudioCodec, &encoding.AudioCodec},
+		{output.AudioBitrate, &encoding.AudioBitrate},
+	} {
+		if setting.value != "" {
+			*setting.field = setting.value
+		}
+	}
+	if output.CRF < 0 || output.CRF > maxCRF {
+		v.addf("output.crf", "invalid crf %d, want 0 to %d", output.CRF, maxCRF)
+	}
+	encoding.CRF = output.CRF
+
+	if len(v.problems) > 0 {
+		return config, &Error{Path: p.path, Problems: v.problems}
+	}
+	return config, nil
+}
@@ -0,0 +1,60 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is an invalid setting, Field being its path in the project
+// file, e.g. "tracks.draw.includeChannels".
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Error reports why a project file can't be used: Err when it can't be read
+// or decoded, Problems listing every invalid setting otherwise.
+type Error struct {
+	Path     string
+	Err      error
+	Problems []*FieldError
+}
+
+func (e *Error) Error() string {
+	var path = e.Path
+	if path == "" {
+		path = "project"
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", path, e.Err)
+	}
+	if len(e.Problems) == 1 {
+		return fmt.Sprintf("%s: %v", path, e.Problems[0])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d invalid settings:", path, len(e.Problems))
+	for _, problem := range e.Problems {
+		fmt.Fprintf(&b, "\n  %v", problem)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() []error {
+	var errs = []error{}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	for _, problem := range e.Problems {
+		errs = append(errs, problem)
+	}
+	return errs
+}
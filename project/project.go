@@ -0,0 +1,125 @@
+package project
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var decoders = map[string]func(data []byte, p *Project) error{
+	"yaml": decodeYAML,
+	"yml":  decodeYAML,
+	"json": decodeJSON,
+	"toml": decodeTOML,
+}
+
+// Load reads and validates the YAML, JSON or TOML project file at path, the
+// format being picked by its extension. Errors are of type *Error.
+func Load(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &Error{Path: path, Err: err}
+	}
+
+	p, err := Parse(data, filepath.Ext(path))
+	if err != nil {
+		return nil, &Error{Path: path, Err: err}
+	}
+	p.path = path
+
+	if _, err := p.Config(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Parse decodes a project written in format, "yaml", "json" or "toml",
+// without validating its settings. Relative paths in it start from the
+// working directory.
+func Parse(data []byte, format string) (*Project, error) {
+	var decode, supported = decoders[strings.ToLower(strings.TrimPrefix(format, "."))]
+	if !supported {
+		return nil, errors.New("unsupported project format, want .yaml, .yml, .json or .toml")
+	}
+
+	var p = &Project{}
+	if err := decode(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func decodeYAML(data []byte, p *Project) error {
+	var decoder = yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func decodeJSON(data []byte, p *Project) error {
+	var decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var err = decoder.Decode(p)
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("line %d: %w", lineAt(data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("line %d: %w", lineAt(data, typeErr.Offset), err)
+	}
+	return err
+}
+
+// lineAt returns the line number of a byte offset.
+func lineAt(data []byte, offset int64) int {
+	offset = min(offset, int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func decodeTOML(data []byte, p *Project) error {
+	metadata, err := toml.Decode(string(data), p)
+	if err != nil {
+		return err
+	}
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		var keys = []string{}
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("unknown field(s) %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// resolvePath makes a path given in the project file relative to the
+// working directory.
+func (p *Project) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) || p.path == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(p.path), path)
+}
+
+// InputPath returns the path of the MIDI file to render.
+func (p *Project) InputPath() string {
+	return p.resolvePath(p.Input)
+}
+
+// OutputPath returns the path of the video, empty when not set.
+func (p *Project) OutputPath() string {
+	return p.resolvePath(p.Output.Path)
+}
@@ -0,0 +1,163 @@
+package project
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"piano-video/videogenerator"
+)
+
+// writeProject writes a project file, and the MIDI file it renders, to a
+// temporary folder.
+func writeProject(t *testing.T, name string, content string) string {
+	var dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "song.mid"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var path = filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	var tests = []struct {
+		name    string
+		file    string
+		content string
+		lowest  int
+		highest int
+	}{
+		{"yaml", "song.yaml", `
+input: song.mid
+resolution: 720p
+keyboard: 5
+leadIn: 0
+overlays:
+  pedals: false
+tracks:
+  drumChannels: [11]
+output:
+  path: song.mp4
+`, 36, 95},
+		{"yaml keyboard size", "song.yml", "input: song.mid\nkeyboard: 88keys\n", 21, 108},
+		{"json", "song.json", `{
+	"input": "song.mid",
+	"resolution": "720p",
+	"keyboard": 5,
+	"leadIn": 0,
+	"overlays": {"pedals": false},
+	"tracks": {"drumChannels": [11]},
+	"output": {"path": "song.mp4"}
+}`, 36, 95},
+		{"json keyboard string", "song.json", `{"input": "song.mid", "keyboard": "5"}`, 36, 95},
+		{"toml", "song.toml", `
+input = "song.mid"
+resolution = "720p"
+keyboard = 5
+leadIn = 0.0
+
+[overlays]
+pedals = false
+
+[tracks]
+drumChannels = [11]
+
+[output]
+path = "song.mp4"
+`, 36, 95},
+		{"toml keyboard size", "song.toml", "input = \"song.mid\"\nkeyboard = \"61keys\"\n", 36, 96},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var path = writeProject(t, test.file, test.content)
+			p, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if p.InputPath() != filepath.Join(filepath.Dir(path), "song.mid") {
+				t.Errorf("InputPath() = %q, want it next to the project", p.InputPath())
+			}
+			config, err := p.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.LowestNote != test.lowest || config.HighestNote != test.highest {
+				t.Errorf("keys = %d to %d, want %d to %d", config.LowestNote, config.HighestNote, test.lowest, test.highest)
+			}
+			if p.Output.Path == "" {
+				return
+			}
+			var defaults = videogenerator.DefaultConfig()
+			if config.Resolution != videogenerator.ScreenResolution([2]float64{1280, 720}) || config.StartDelaySec != 0 || config.ShowPedalLane {
+				t.Errorf("config = %v, %gs lead-in, pedals %v", config.Resolution, config.StartDelaySec, config.ShowPedalLane)
+			}
+			if !reflect.DeepEqual(config.DrumChannels, []byte{10}) || config.FPS != defaults.FPS {
+				t.Errorf("drum channels = %v, fps = %d", config.DrumChannels, config.FPS)
+			}
+			if p.OutputPath() != filepath.Join(filepath.Dir(path), "song.mp4") {
+				t.Errorf("OutputPath() = %q", p.OutputPath())
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		file    string
+		content string
+		// fields are the invalid settings reported, none when the file
+		// can't be decoded.
+		fields []string
+	}{
+		{"unsupported format", "song.txt", "input: song.mid", nil},
+		{"yaml unknown field", "song.yaml", "input: song.mid\nkeys: 5\n", nil},
+		{"json syntax", "song.json", `{"input": "song.mid",}`, nil},
+		{"json wrong type", "song.json", `{"input": "song.mid", "fps": "60"}`, nil},
+		{"json keyboard type", "song.json", `{"input": "song.mid", "keyboard": true}`, nil},
+		{"toml unknown field", "song.toml", "input = \"song.mid\"\nkeys = 5\n", nil},
+		{"toml keyboard type", "song.toml", "input = \"song.mid\"\nkeyboard = 5.5\n", nil},
+		{"missing input", "song.yaml", "input: other.mid\n", []string{"input"}},
+		{"keyboard", "song.yaml", "input: song.mid\nkeyboard: 11\n", []string{"keyboard"}},
+		{"json keyboard", "song.json", `{"input": "song.mid", "keyboard": 0}`, []string{"keyboard"}},
+		{"every problem", "song.yaml", `
+input: song.mid
+theme: sepia
+fps: 1000
+leadIn: -1
+tracks:
+  draw:
+    includeChannels: [0, 3]
+  drumChannels: [17]
+output:
+  crf: 60
+`, []string{"theme", "fps", "leadIn", "tracks.draw.includeChannels[0]", "tracks.drumChannels[0]", "output.crf"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(writeProject(t, test.file, test.content))
+			var projectErr *Error
+			if !errors.As(err, &projectErr) {
+				t.Fatalf("Load() error = %v, want an *Error", err)
+			}
+			if test.fields == nil {
+				if projectErr.Err == nil {
+					t.Errorf("Load() error = %v, want a decoding error", err)
+				}
+				return
+			}
+			var fields = []string{}
+			for _, problem := range projectErr.Problems {
+				fields = append(fields, problem.Field)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("invalid settings = %v, want %v\n%v", fields, test.fields, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Project is a render recipe as written in a project file. Paths are
+// relative to the project file and fields left out keep the defaults of
+// videogenerator.DefaultConfig.
+type Project struct {
+	// Input is the MIDI file to render, Audio an optional recording played
+	// instead of the synthesized MIDI file.
+	Input string `yaml:"input" json:"input" toml:"input"`
+	Audio string `yaml:"audio" json:"audio" toml:"audio"`
+	// Synth is timidity, fluidsynth or builtin, the last two playing the
+	// SF2 file SoundFont. A sound font alone picks builtin.
+	Synth     string `yaml:"synth" json:"synth" toml:"synth"`
+	SoundFont string `yaml:"soundFont" json:"soundFont" toml:"soundFont"`
+
+	Theme string `yaml:"theme" json:"theme" toml:"theme"`
+	// Colors replace the theme's note colors, given as "#rrggbb" and picked
+	// per track, channel or instrument as set by ColorBy.
+	Colors  []string `yaml:"colors" json:"colors" toml:"colors"`
+	ColorBy string   `yaml:"colorBy" json:"colorBy" toml:"colorBy"`
+
+	Resolution string   `yaml:"resolution" json:"resolution" toml:"resolution"`
+	FPS        int      `yaml:"fps" json:"fps" toml:"fps"`
+	Keyboard   Keyboard `yaml:"keyboard" json:"keyboard" toml:"keyboard"`
+	LeadIn     *float64 `yaml:"leadIn" json:"leadIn" toml:"leadIn"`
+	Workers    int      `yaml:"workers" json:"workers" toml:"workers"`
+
+	TitleCard *TitleCard `yaml:"titleCard" json:"titleCard" toml:"titleCard"`
+	Overlays  Overlays   `yaml:"overlays" json:"overlays" toml:"overlays"`
+	Tracks    Tracks     `yaml:"tracks" json:"tracks" toml:"tracks"`
+	Output    Output     `yaml:"output" json:"output" toml:"output"`
+
+	// path is the project file, which relative paths start from.
+	path string
+}
+
+// Keyboard is the keys to draw, as videogenerator.ParseKeyboard reads them.
+// A number of octaves may be written as a number or a string.
+type Keyboard string
+
+func (k *Keyboard) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		*k = Keyboard(number)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("invalid keyboard %s, want a number of octaves or a keyboard size", data)
+	}
+	*k = Keyboard(name)
+	return nil
+}
+
+func (k *Keyboard) UnmarshalTOML(value any) error {
+	switch value := value.(type) {
+	case string:
+		*k = Keyboard(value)
+	case int64:
+		*k = Keyboard(strconv.FormatInt(value, 10))
+	default:
+		return fmt.Errorf("invalid keyboard %v, want a number of octaves or a keyboard size", value)
+	}
+	return nil
+}
+
+type TitleCard struct {
+	Title    string  `yaml:"title" json:"title" toml:"title"`
+	Subtitle string  `yaml:"subtitle" json:"subtitle" toml:"subtitle"`
+	Duration float64 `yaml:"duration" json:"duration" toml:"duration"`
+}
+
+// Overlays switches the parts of the video drawn besides the keyboard and
+// notes on or off.
+type Overlays struct {
+	VelocityShading *bool `yaml:"velocityShading" json:"velocityShading" toml:"velocityShading"`
+	Pedals          *bool `yaml:"pedals" json:"pedals" toml:"pedals"`
+	SustainTails    *bool `yaml:"sustainTails" json:"sustainTails" toml:"sustainTails"`
+	Lyrics          *bool `yaml:"lyrics" json:"lyrics" toml:"lyrics"`
+	DrumStrip       *bool `yaml:"drumStrip" json:"drumStrip" toml:"drumStrip"`
+	Chapters        *bool `yaml:"chapters" json:"chapters" toml:"chapters"`
+	Subtitles       *bool `yaml:"subtitles" json:"subtitles" toml:"subtitles"`
+}
+
+// Tracks picks what is drawn and what is heard. Draw replaces the default
+// selection, which leaves out synth and sound effect patches. DrumChannels
+// are played on drum pads rather than keys besides General MIDI channel 10,
+// unless DrumsOnKeyboard keeps them on the keys as well.
+type Tracks struct {
+	Draw            *Selection `yaml:"draw" json:"draw" toml:"draw"`
+	Audio           *Selection `yaml:"audio" json:"audio" toml:"audio"`
+	DrumChannels    []int      `yaml:"drumChannels" json:"drumChannels" toml:"drumChannels"`
+	DrumsOnKeyboard *bool      `yaml:"drumsOnKeyboard" json:"drumsOnKeyboard" toml:"drumsOnKeyboard"`
+}
+
+// Selection mirrors videogenerator.Selection, with channels numbered 1 to
+// 16 and patches 0 to 127.
+type Selection struct {
+	IncludeTracks     []int    `yaml:"includeTracks" json:"includeTracks" toml:"includeTracks"`
+	ExcludeTracks     []int    `yaml:"excludeTracks" json:"excludeTracks" toml:"excludeTracks"`
+	IncludeTrackNames []string `yaml:"includeTrackNames" json:"includeTrackNames" toml:"includeTrackNames"`
+	ExcludeTrackNames []string `yaml:"excludeTrackNames" json:"excludeTrackNames" toml:"excludeTrackNames"`
+	IncludeChannels   []int    `yaml:"includeChannels" json:"includeChannels" toml:"includeChannels"`
+	ExcludeChannels   []int    `yaml:"excludeChannels" json:"excludeChannels" toml:"excludeChannels"`
+	IncludePatches    []int    `yaml:"includePatches" json:"includePatches" toml:"includePatches"`
+	ExcludePatches    []int    `yaml:"excludePatches" json:"excludePatches" toml:"excludePatches"`
+	IncludeFamilies   []string `yaml:"includeFamilies" json:"includeFamilies" toml:"includeFamilies"`
+	ExcludeFamilies   []string `yaml:"excludeFamilies" json:"excludeFamilies" toml:"excludeFamilies"`
+}
+
+// Output is where the video goes and how it is encoded, see
+// videogenerator.Encoding.
+type Output struct {
+	Path         string `yaml:"path" json:"path" toml:"path"`
+	VideoCodec   string `yaml:"videoCodec" json:"videoCodec" toml:"videoCodec"`
+	Preset       string `yaml:"preset" json:"preset" toml:"preset"`
+	Tune         string `yaml:"tune" json:"tune" toml:"tune"`
+	PixelFormat  string `yaml:"pixelFormat" json:"pixelFormat" toml:"pixelFormat"`
+	CRF          int    `yaml:"crf" json:"crf" toml:"crf"`
+	AudioCodec   string `yaml:"audioCodec" json:"audioCodec" toml:"audioCodec"`
+	AudioBitrate string `yaml:"audioBitrate" json:"audioBitrate" toml:"audioBitrate"`
+}
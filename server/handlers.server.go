@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"piano-video/midiparser"
+	"piano-video/project"
+	"piano-video/videogenerator"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// readSettings reads the render settings of a job, written as a JSON
+// project without the paths, which the server picks. Jobs are synthesized
+// with the server's sound font, if it has one.
+func readSettings(settings string, soundFont string) (videogenerator.Config, error) {
+	var p = &project.Project{}
+	if settings != "" {
+		var err error
+		if p, err = project.Parse([]byte(settings), "json"); err != nil {
+			return videogenerator.Config{}, fmt.Errorf("settings: %w", err)
+		}
+	}
+	if p.Input != "" || p.Audio != "" || p.SoundFont != "" || p.Output.Path != "" {
+		return videogenerator.Config{}, errors.New("settings: input, audio, soundFont and output.path can't be set")
+	}
+	p.SoundFont = soundFont
+	config, err := p.Config()
+	if err != nil {
+		return videogenerator.Config{}, err
+	}
+	return config, limitSettings(p, &config)
+}
+
+// Limits of the settings of a job, so that one request can't take all the
+// server's memory. Each frame worker draws on a canvas of its own, which
+// also holds the frame while it waits to be written to ffmpeg.
+const (
+	maxJobWidth      = 3840
+	maxJobHeight     = 2160
+	maxJobFrameBytes = 1 << 30
+)
+
+// limitSettings rejects videos larger than 4K and more workers than the
+// frame memory allows, lowering the default number of workers to fit.
+func limitSettings(p *project.Project, config *videogenerator.Config) error {
+	var width, height = config.Resolution[0], config.Resolution[1]
+	if width > maxJobWidth || height > maxJobHeight {
+		return fmt.Errorf("settings: resolution %gx%g larger than %dx%d", width, height, maxJobWidth, maxJobHeight)
+	}
+	// A canvas of 4 bytes per pixel for each worker, counted twice as the
+	// garbage collector lets the heap grow to twice what is in use.
+	var maxWorkers = max(int(maxJobFrameBytes/(2*4*width*height)), 1)
+	if p.Workers > maxWorkers {
+		return fmt.Errorf("settings: %d workers at %gx%g, want at most %d", p.Workers, width, height, maxWorkers)
+	}
+	config.Workers = min(config.Workers, maxWorkers)
+	return nil
+}
+
+// createJob handles POST /jobs, a multipart form with the MIDI file as
+// "midi" and optional JSON settings as "settings".
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.options.MaxUploadBytes)
+	if err := r.ParseMultipartForm(s.options.MaxUploadBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("upload larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("midi")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("midi: %w", err))
+		return
+	}
+	defer file.Close()
+	midiData, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("midi: %w", err))
+		return
+	}
+	if _, err := midiparser.Parse(bytes.NewReader(midiData)); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("midi: %w", err))
+		return
+	}
+
+	config, err := readSettings(r.FormValue("settings"), s.options.SoundFont)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dir, err := os.MkdirTemp(s.options.WorkDir, "job-")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	config.FramesFolderPath = dir
+
+	var j = &job{
+		id:        newJobID(),
+		fileName:  filepath.Base(header.Filename),
+		dir:       dir,
+		midiPath:  filepath.Join(dir, "input.mid"),
+		videoPath: filepath.Join(dir, "video.mp4"),
+		config:    config,
+		status:    StatusQueued,
+		createdAt: time.Now(),
+		changed:   make(chan struct{}),
+	}
+	if err := os.WriteFile(j.midiPath, midiData, 0644); err != nil {
+		os.RemoveAll(dir)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.enqueue(j); err != nil {
+		os.RemoveAll(dir)
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	info, _ := s.jobInfo(j.id)
+	w.Header().Set("Location", "/jobs/"+j.id)
+	writeJSON(w, http.StatusAccepted, info)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	info, exists := s.jobInfo(mux.Vars(r)["id"])
+	if !exists {
+		writeError(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// streamJob handles GET /jobs/{id}/events, sending the job's info as a
+// server-sent event each time it changes, until it finishes or is deleted,
+// or the server closes.
+func (s *Server) streamJob(w http.ResponseWriter, r *http.Request) {
+	var id = mux.Vars(r)["id"]
+	info, changed, exists := s.watchJob(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+	var flusher, canFlush = w.(http.Flusher)
+	if !canFlush {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for {
+		data, err := json.Marshal(info)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", info.Status, data)
+		flusher.Flush()
+		if info.Status != StatusQueued && info.Status != StatusRunning {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case <-changed:
+		}
+		if info, changed, exists = s.watchJob(id); !exists {
+			fmt.Fprint(w, "event: deleted\ndata: {}\n\n")
+			return
+		}
+	}
+}
+
+func (s *Server) getVideo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var j, exists = s.jobs[mux.Vars(r)["id"]]
+	var status JobStatus
+	var videoPath, fileName string
+	if exists {
+		status, videoPath, fileName = j.status, j.videoPath, j.fileName
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+	if status != StatusDone {
+		writeError(w, http.StatusConflict, fmt.Errorf("job is %s", status))
+		return
+	}
+
+	var name = fileName[:len(fileName)-len(filepath.Ext(fileName))] + ".mp4"
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, videoPath)
+}
+
+// deleteJob cancels a job if it hasn't finished and removes it with its
+// video.
+func (s *Server) deleteJob(w http.ResponseWriter, r *http.Request) {
+	if !s.remove(mux.Vars(r)["id"]) {
+		writeError(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
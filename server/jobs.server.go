@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"piano-video/videogenerator"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	StatusQueued   JobStatus = "queued"
+	StatusRunning  JobStatus = "running"
+	StatusDone     JobStatus = "done"
+	StatusFailed   JobStatus = "failed"
+	StatusCanceled JobStatus = "canceled"
+)
+
+// job is a render request. Its fields are guarded by the server's mutex
+// once the job is queued.
+type job struct {
+	id        string
+	fileName  string
+	dir       string
+	midiPath  string
+	videoPath string
+	config    videogenerator.Config
+
+	status     JobStatus
+	progress   videogenerator.Progress
+	err        error
+	createdAt  time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// changed is closed, and replaced, whenever the job's info changes.
+	changed chan struct{}
+}
+
+// JobInfo is the state of a job as GET /jobs/{id} reports it.
+type JobInfo struct {
+	ID            string        `json:"id"`
+	FileName      string        `json:"fileName"`
+	Status        JobStatus     `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	QueuePosition int           `json:"queuePosition,omitempty"`
+	Progress      *ProgressInfo `json:"progress,omitempty"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	StartedAt     *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time    `json:"finishedAt,omitempty"`
+	VideoURL      string        `json:"videoUrl,omitempty"`
+}
+
+// ProgressInfo is how far a render got, once it started.
+type ProgressInfo struct {
+	Stage          videogenerator.Stage `json:"stage"`
+	FramesDone     int                  `json:"framesDone"`
+	FramesTotal    int                  `json:"framesTotal"`
+	ElapsedSeconds float64              `json:"elapsedSeconds"`
+	ETASeconds     float64              `json:"etaSeconds,omitempty"`
+}
+
+func newJobID() string {
+	var b = make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (j *job) isFinished() bool {
+	return j.status == StatusDone || j.status == StatusFailed || j.status == StatusCanceled
+}
+
+func (j *job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (j *job) info() JobInfo {
+	var info = JobInfo{
+		ID:         j.id,
+		FileName:   j.fileName,
+		Status:     j.status,
+		CreatedAt:  j.createdAt,
+		StartedAt:  optionalTime(j.startedAt),
+		FinishedAt: optionalTime(j.finishedAt),
+	}
+	if j.progress.Stage != "" {
+		info.Progress = &ProgressInfo{
+			Stage:          j.progress.Stage,
+			FramesDone:     j.progress.FramesDone,
+			FramesTotal:    j.progress.FramesTotal,
+			ElapsedSeconds: j.progress.Elapsed.Seconds(),
+			ETASeconds:     j.progress.ETA.Seconds(),
+		}
+	}
+	if j.err != nil {
+		info.Error = j.err.Error()
+	}
+	if j.status == StatusDone {
+		info.VideoURL = "/jobs/" + j.id + "/video"
+	}
+	return info
+}
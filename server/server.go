@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"piano-video/videogenerator"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var errQueueFull = errors.New("the render queue is full, try again later")
+
+// Options configure a Server. Zero values pick the defaults.
+type Options struct {
+	// WorkDir holds a temporary folder per job, with its MIDI file, frames
+	// and video. It defaults to the system's temporary folder.
+	WorkDir string
+	// Workers is the number of videos rendered at a time, QueueSize the
+	// number of jobs waiting for a worker before new ones are refused.
+	Workers   int
+	QueueSize int
+	// MaxUploadBytes limits the size of POST /jobs requests.
+	MaxUploadBytes int64
+	// KeepFinished is how long finished jobs and their videos are kept.
+	KeepFinished time.Duration
+	// SoundFont is the SF2 file jobs are synthesized with, by the builtin
+	// synth unless their settings pick fluidsynth. Without it, timidity
+	// plays them.
+	SoundFont string
+}
+
+const (
+	defaultWorkers        = 1
+	defaultQueueSize      = 16
+	defaultMaxUploadBytes = 8 << 20
+	defaultKeepFinished   = 24 * time.Hour
+)
+
+// Server renders uploaded MIDI files into videos in the background.
+type Server struct {
+	options Options
+	router  *mux.Router
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	queue []*job
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// renderVideo renders a job's MIDI file; tests replace it.
+	renderVideo func(ctx context.Context, config videogenerator.Config, midiPath string, videoPath string) error
+}
+
+func renderVideo(ctx context.Context, config videogenerator.Config, midiPath string, videoPath string) error {
+	return videogenerator.NewRenderer(config).Render(ctx, midiPath, videoPath)
+}
+
+// New creates a Server and starts its workers; Close stops them.
+func New(options Options) (*Server, error) {
+	if options.WorkDir == "" {
+		options.WorkDir = filepath.Join(os.TempDir(), "piano-video")
+	}
+	if options.Workers <= 0 {
+		options.Workers = defaultWorkers
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaultQueueSize
+	}
+	if options.MaxUploadBytes <= 0 {
+		options.MaxUploadBytes = defaultMaxUploadBytes
+	}
+	if options.KeepFinished <= 0 {
+		options.KeepFinished = defaultKeepFinished
+	}
+	if err := os.MkdirAll(options.WorkDir, 0755); err != nil {
+		return nil, err
+	}
+	if options.SoundFont != "" {
+		if _, err := os.Stat(options.SoundFont); err != nil {
+			return nil, err
+		}
+	}
+
+	var s = &Server{
+		options:     options,
+		jobs:        map[string]*job{},
+		wake:        make(chan struct{}, options.Workers),
+		renderVideo: renderVideo,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.routes()
+
+	for i := 0; i < options.Workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	s.wg.Add(1)
+	go s.removeExpiredJobs()
+	return s, nil
+}
+
+func (s *Server) routes() {
+	s.router = mux.NewRouter()
+	s.router.HandleFunc("/jobs", s.createJob).Methods(http.MethodPost)
+	s.router.HandleFunc("/jobs/{id}", s.getJob).Methods(http.MethodGet)
+	s.router.HandleFunc("/jobs/{id}/events", s.streamJob).Methods(http.MethodGet)
+	s.router.HandleFunc("/jobs/{id}/video", s.getVideo).Methods(http.MethodGet)
+	s.router.HandleFunc("/jobs/{id}", s.deleteJob).Methods(http.MethodDelete)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Close cancels the jobs left, waits for the workers to stop and removes
+// every job's folder.
+func (s *Server) Close() {
+	s.cancel()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, j := range s.jobs {
+		os.RemoveAll(j.dir)
+		delete(s.jobs, id)
+	}
+	s.queue = nil
+}
+
+// enqueue adds a job to the queue, unless it is full.
+func (s *Server) enqueue(j *job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) >= s.options.QueueSize {
+		return errQueueFull
+	}
+	j.ctx, j.cancel = context.WithCancel(s.ctx)
+	s.jobs[j.id] = j
+	s.queue = append(s.queue, j)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// next takes the oldest queued job, or nil when there is none.
+func (s *Server) next() *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return nil
+	}
+	var j = s.queue[0]
+	s.queue = s.queue[1:]
+	j.status = StatusRunning
+	j.startedAt = time.Now()
+	j.notify()
+	s.notifyQueued()
+	return j
+}
+
+// notifyQueued tells the queued jobs that their place in the queue changed.
+func (s *Server) notifyQueued() {
+	for _, queued := range s.queue {
+		queued.notify()
+	}
+}
+
+func (s *Server) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+		}
+		for j := s.next(); j != nil; j = s.next() {
+			s.run(j)
+		}
+	}
+}
+
+func (s *Server) run(j *job) {
+	var config = j.config
+	config.Progress = func(progress videogenerator.Progress) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		j.progress = progress
+		j.notify()
+	}
+	var err = s.render(j, config)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.finishedAt = time.Now()
+	switch {
+	case j.ctx.Err() != nil:
+		j.status = StatusCanceled
+	case err != nil:
+		j.status = StatusFailed
+		j.err = err
+		log.Printf("job %s: %v", j.id, err)
+	default:
+		j.status = StatusDone
+	}
+	j.cancel()
+	j.notify()
+
+	// The job was deleted while it rendered.
+	if _, exists := s.jobs[j.id]; !exists {
+		os.RemoveAll(j.dir)
+	}
+}
+
+// render renders a job, turning a panic of the render code into an error,
+// so that a file breaking it fails its job rather than the server.
+func (s *Server) render(j *job, config videogenerator.Config) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("job %s: panic: %v\n%s", j.id, recovered, debug.Stack())
+			err = fmt.Errorf("rendering failed: %v", recovered)
+		}
+	}()
+	return s.renderVideo(j.ctx, config, j.midiPath, j.videoPath)
+}
+
+// remove forgets a job, canceling it if unfinished. A running job's folder
+// is removed by its worker once it stops.
+func (s *Server) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var j, exists = s.jobs[id]
+	if !exists {
+		return false
+	}
+	delete(s.jobs, id)
+	j.cancel()
+	j.notify()
+
+	switch j.status {
+	case StatusQueued:
+		for i, queued := range s.queue {
+			if queued == j {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		s.notifyQueued()
+		os.RemoveAll(j.dir)
+	case StatusRunning:
+	default:
+		os.RemoveAll(j.dir)
+	}
+	return true
+}
+
+func (s *Server) removeExpiredJobs() {
+	defer s.wg.Done()
+	var ticker = time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			var expired = []string{}
+			s.mu.Lock()
+			for id, j := range s.jobs {
+				if j.isFinished() && now.Sub(j.finishedAt) > s.options.KeepFinished {
+					expired = append(expired, id)
+				}
+			}
+			s.mu.Unlock()
+			for _, id := range expired {
+				s.remove(id)
+			}
+		}
+	}
+}
+
+// jobInfo returns the state of a job and its place in the queue.
+func (s *Server) jobInfo(id string) (JobInfo, bool) {
+	info, _, exists := s.watchJob(id)
+	return info, exists
+}
+
+// watchJob returns the state of a job along with a channel closed once it
+// changes.
+func (s *Server) watchJob(id string) (JobInfo, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var j, exists = s.jobs[id]
+	if !exists {
+		return JobInfo{}, nil, false
+	}
+	var info = j.info()
+	for i, queued := range s.queue {
+		if queued == j {
+			info.QueuePosition = i + 1
+		}
+	}
+	return info, j.changed, true
+}
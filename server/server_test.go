@@ -0,0 +1,299 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"piano-video/videogenerator"
+)
+
+// testMidi is a file with one track playing middle C for a quarter note.
+var testMidi = []byte{
+	'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96,
+	'M', 'T', 'r', 'k', 0, 0, 0, 12,
+	0x00, 0x90, 60, 100, 0x60, 0x80, 60, 0, 0x00, 0xFF, 0x2F, 0x00,
+}
+
+// newTestServer starts a Server whose jobs are rendered by render, served
+// over HTTP.
+func newTestServer(t *testing.T, options Options, render func(ctx context.Context, config videogenerator.Config, midiPath string, videoPath string) error) (*Server, *httptest.Server) {
+	options.WorkDir = t.TempDir()
+	s, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.renderVideo = render
+	var httpServer = httptest.NewServer(s)
+	t.Cleanup(func() {
+		httpServer.Close()
+		s.Close()
+	})
+	return s, httpServer
+}
+
+// writeVideo is a render writing a fake video.
+func writeVideo(ctx context.Context, config videogenerator.Config, midiPath string, videoPath string) error {
+	return os.WriteFile(videoPath, []byte("video"), 0644)
+}
+
+// waitForCancel is a render running until its job is canceled.
+func waitForCancel(ctx context.Context, config videogenerator.Config, midiPath string, videoPath string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// postJob uploads midi with settings, leaving out the fields given as nil.
+func postJob(t *testing.T, url string, midi []byte, settings *string) *http.Response {
+	var body bytes.Buffer
+	var form = multipart.NewWriter(&body)
+	if midi != nil {
+		part, _ := form.CreateFormFile("midi", "song.mid")
+		part.Write(midi)
+	}
+	if settings != nil {
+		form.WriteField("settings", *settings)
+	}
+	form.Close()
+	response, err := http.Post(url+"/jobs", form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+// createJob uploads testMidi and returns the job created.
+func createJob(t *testing.T, url string) JobInfo {
+	var response = postJob(t, url, testMidi, nil)
+	if response.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(response.Body)
+		t.Fatalf("POST /jobs status = %d, want %d: %s", response.StatusCode, http.StatusAccepted, body)
+	}
+	var info JobInfo
+	if err := json.NewDecoder(response.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if location := response.Header.Get("Location"); location != "/jobs/"+info.ID {
+		t.Errorf("Location = %q, want /jobs/%s", location, info.ID)
+	}
+	return info
+}
+
+// waitForStatus waits until a job has the given status and returns it.
+func waitForStatus(t *testing.T, s *Server, id string, status JobStatus) JobInfo {
+	var timeout = time.After(5 * time.Second)
+	for {
+		info, changed, exists := s.watchJob(id)
+		if !exists {
+			t.Fatalf("job %s is gone, want it %s", id, status)
+		}
+		if info.Status == status {
+			return info
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("job %s is %s, want %s", id, info.Status, status)
+		}
+	}
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, body
+}
+
+func TestCreateJob(t *testing.T) {
+	s, httpServer := newTestServer(t, Options{}, writeVideo)
+	var created = createJob(t, httpServer.URL)
+	if created.FileName != "song.mid" || (created.Status != StatusQueued && created.Status != StatusRunning) {
+		t.Errorf("created job = %+v", created)
+	}
+
+	var done = waitForStatus(t, s, created.ID, StatusDone)
+	if done.VideoURL != "/jobs/"+created.ID+"/video" || done.FinishedAt == nil {
+		t.Errorf("finished job = %+v", done)
+	}
+	status, body := get(t, httpServer.URL+"/jobs/"+created.ID)
+	var info JobInfo
+	if status != http.StatusOK || json.Unmarshal(body, &info) != nil || info.Status != StatusDone {
+		t.Errorf("GET /jobs/{id} = %d %s", status, body)
+	}
+	if status, body := get(t, httpServer.URL+done.VideoURL); status != http.StatusOK || string(body) != "video" {
+		t.Errorf("GET %s = %d %q", done.VideoURL, status, body)
+	}
+	if status, _ := get(t, httpServer.URL+"/jobs/unknown"); status != http.StatusNotFound {
+		t.Errorf("GET of an unknown job status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestCreateJobErrors(t *testing.T) {
+	var settings = func(value string) *string {
+		return &value
+	}
+	var tests = []struct {
+		name     string
+		midi     []byte
+		settings *string
+		status   int
+		message  string
+	}{
+		{"no MIDI file", nil, nil, http.StatusBadRequest, "midi"},
+		{"not a MIDI file", []byte("RIFF...."), nil, http.StatusBadRequest, "midi"},
+		{"upload too large", bytes.Repeat(testMidi, 100), nil, http.StatusRequestEntityTooLarge, "upload larger"},
+		{"invalid JSON", testMidi, settings(`{"fps":`), http.StatusBadRequest, "settings"},
+		{"invalid setting", testMidi, settings(`{"fps": 1000}`), http.StatusBadRequest, "fps"},
+		{"paths", testMidi, settings(`{"input": "/etc/passwd"}`), http.StatusBadRequest, "can't be set"},
+		{"resolution", testMidi, settings(`{"resolution": "7680x4320"}`), http.StatusBadRequest, "resolution"},
+		{"workers", testMidi, settings(`{"resolution": "3840x2160", "workers": 1000}`), http.StatusBadRequest, "workers"},
+	}
+	_, httpServer := newTestServer(t, Options{MaxUploadBytes: 1024}, writeVideo)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var response = postJob(t, httpServer.URL, test.midi, test.settings)
+			var body struct {
+				Error string `json:"error"`
+			}
+			json.NewDecoder(response.Body).Decode(&body)
+			if response.StatusCode != test.status || !strings.Contains(body.Error, test.message) {
+				t.Errorf("POST /jobs = %d %q, want %d and %q", response.StatusCode, body.Error, test.status, test.message)
+			}
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	s, httpServer := newTestServer(t, Options{Workers: 1, QueueSize: 1}, waitForCancel)
+	var running = createJob(t, httpServer.URL)
+	waitForStatus(t, s, running.ID, StatusRunning)
+	var queued = createJob(t, httpServer.URL)
+	if info, _ := s.jobInfo(queued.ID); info.Status != StatusQueued || info.QueuePosition != 1 {
+		t.Errorf("second job = %+v, want first in the queue", info)
+	}
+
+	var response = postJob(t, httpServer.URL, testMidi, nil)
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("POST /jobs with a full queue status = %d, want %d", response.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestDeleteJob(t *testing.T) {
+	s, httpServer := newTestServer(t, Options{Workers: 1}, waitForCancel)
+	var running = createJob(t, httpServer.URL)
+	waitForStatus(t, s, running.ID, StatusRunning)
+	var queued = createJob(t, httpServer.URL)
+	s.mu.Lock()
+	var runningDir, queuedDir = s.jobs[running.ID].dir, s.jobs[queued.ID].dir
+	s.mu.Unlock()
+
+	var remove = func(id string) int {
+		request, _ := http.NewRequest(http.MethodDelete, httpServer.URL+"/jobs/"+id, nil)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	if status := remove(queued.ID); status != http.StatusNoContent {
+		t.Errorf("DELETE of a queued job status = %d, want %d", status, http.StatusNoContent)
+	}
+	if _, err := os.Stat(queuedDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("folder of the deleted queued job: %v, want it removed", err)
+	}
+
+	// A running job is canceled, and its folder removed once it stops.
+	_, changed, _ := s.watchJob(running.ID)
+	if status := remove(running.ID); status != http.StatusNoContent {
+		t.Errorf("DELETE of a running job status = %d, want %d", status, http.StatusNoContent)
+	}
+	<-changed
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(runningDir); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("folder of the deleted running job is still there")
+		}
+	}
+	if status, _ := get(t, httpServer.URL+"/jobs/"+running.ID); status != http.StatusNotFound {
+		t.Errorf("GET of a deleted job status = %d, want %d", status, http.StatusNotFound)
+	}
+	if status := remove(running.ID); status != http.StatusNotFound {
+		t.Errorf("second DELETE status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestRenderPanic(t *testing.T) {
+	var panics = true
+	s, httpServer := newTestServer(t, Options{Workers: 1}, func(ctx context.Context, config videogenerator.Config, midiPath string, videoPath string) error {
+		if panics {
+			panics = false
+			panic("broken file")
+		}
+		return writeVideo(ctx, config, midiPath, videoPath)
+	})
+
+	var failed = waitForStatus(t, s, createJob(t, httpServer.URL).ID, StatusFailed)
+	if !strings.Contains(failed.Error, "broken file") {
+		t.Errorf("job error = %q, want the panic", failed.Error)
+	}
+	// The worker goes on with the next job.
+	waitForStatus(t, s, createJob(t, httpServer.URL).ID, StatusDone)
+}
+
+func TestStreamEndsOnClose(t *testing.T) {
+	// A render slow to stop, which keeps its job running after Close.
+	var release = make(chan struct{})
+	s, httpServer := newTestServer(t, Options{}, func(ctx context.Context, config videogenerator.Config, midiPath string, videoPath string) error {
+		<-release
+		return ctx.Err()
+	})
+	var running = createJob(t, httpServer.URL)
+	waitForStatus(t, s, running.ID, StatusRunning)
+
+	response, err := http.Get(httpServer.URL + "/jobs/" + running.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var events = make(chan string)
+	go func() {
+		body, _ := io.ReadAll(response.Body)
+		events <- string(body)
+	}()
+
+	var closed = make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case body := <-events:
+		if !strings.HasPrefix(body, "event: running\n") {
+			t.Errorf("events = %q, want the running job's", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("event stream still open after Close")
+	}
+	close(release)
+	<-closed
+}
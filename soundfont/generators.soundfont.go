@@ -0,0 +1,124 @@
+package soundfont
+
+// Generators are the parameters of a zone, numbered as in the SoundFont
+// 2.04 specification. Only those the synthesizer uses are named.
+const (
+	genStartAddrsOffset           = 0
+	genEndAddrsOffset             = 1
+	genStartloopAddrsOffset       = 2
+	genEndloopAddrsOffset         = 3
+	genStartAddrsCoarseOffset     = 4
+	genEndAddrsCoarseOffset       = 12
+	genPan                        = 17
+	genDelayVolEnv                = 33
+	genAttackVolEnv               = 34
+	genHoldVolEnv                 = 35
+	genDecayVolEnv                = 36
+	genSustainVolEnv              = 37
+	genReleaseVolEnv              = 38
+	genKeynumToVolEnvHold         = 39
+	genKeynumToVolEnvDecay        = 40
+	genInstrument                 = 41
+	genKeyRange                   = 43
+	genVelRange                   = 44
+	genStartloopAddrsCoarseOffset = 45
+	genKeynum                     = 46
+	genVelocity                   = 47
+	genInitialAttenuation         = 48
+	genEndloopAddrsCoarseOffset   = 50
+	genCoarseTune                 = 51
+	genFineTune                   = 52
+	genSampleID                   = 53
+	genSampleModes                = 54
+	genScaleTuning                = 56
+	genExclusiveClass             = 57
+	genOverridingRootKey          = 58
+
+	genCount = 61
+)
+
+// Sample modes of genSampleModes.
+const (
+	sampleNoLoop           = 0
+	sampleLoop             = 1
+	sampleLoopUntilRelease = 3
+)
+
+// presetIgnored are the generators that only instruments set; presets
+// setting them are ignored.
+var presetIgnored = map[int]bool{
+	genStartAddrsOffset: true, genEndAddrsOffset: true,
+	genStartloopAddrsOffset: true, genEndloopAddrsOffset: true,
+	genStartAddrsCoarseOffset: true, genEndAddrsCoarseOffset: true,
+	genStartloopAddrsCoarseOffset: true, genEndloopAddrsCoarseOffset: true,
+	genKeynum: true, genVelocity: true, genSampleID: true, genSampleModes: true,
+	genExclusiveClass: true, genOverridingRootKey: true,
+}
+
+type generator struct {
+	operator uint16
+	amount   int16
+}
+
+type generators struct {
+	values [genCount]int16
+}
+
+// fullRange is a key or velocity range from 0 to 127, the low end in the
+// low byte.
+const fullRange = 127 << 8
+
+func defaultGenerators() generators {
+	var g = generators{}
+	for _, envelope := range []int{genDelayVolEnv, genAttackVolEnv, genHoldVolEnv, genDecayVolEnv, genReleaseVolEnv} {
+		g.values[envelope] = -12000
+	}
+	g.values[genKeyRange] = fullRange
+	g.values[genVelRange] = fullRange
+	g.values[genKeynum] = -1
+	g.values[genVelocity] = -1
+	g.values[genScaleTuning] = 100
+	g.values[genOverridingRootKey] = -1
+	return g
+}
+
+func presetBaseGenerators() generators {
+	var g = generators{}
+	g.values[genKeyRange] = fullRange
+	g.values[genVelRange] = fullRange
+	return g
+}
+
+func (g *generators) set(gen generator) {
+	if int(gen.operator) < genCount {
+		g.values[gen.operator] = gen.amount
+	}
+}
+
+func (g generators) get(operator int) int {
+	return int(g.values[operator])
+}
+
+// index reads an instrument or sample index, which is unsigned.
+func (g generators) index(operator int) int {
+	return int(uint16(g.values[operator]))
+}
+
+// inRange reports whether a key or velocity range holds value.
+func (g generators) inRange(operator int, value int) bool {
+	var r = uint16(g.values[operator])
+	return value >= int(r&0xFF) && value <= int(r>>8)
+}
+
+// plus adds the generators of a preset zone to those of an instrument zone.
+func (g generators) plus(preset generators) [genCount]int {
+	var sum = [genCount]int{}
+	for operator, value := range g.values {
+		sum[operator] = int(value)
+		if presetIgnored[operator] || operator == genKeyRange || operator == genVelRange || operator == genInstrument {
+			continue
+		}
+		sum[operator] += int(preset.values[operator])
+	}
+	return sum
+}
@@ -0,0 +1,383 @@
+package soundfont
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrNotSoundFont = errors.New("not a SoundFont 2 file")
+	ErrMissingChunk = errors.New("missing chunk")
+	ErrChunkSize    = errors.New("invalid chunk size")
+	ErrBadIndex     = errors.New("index out of range")
+)
+
+// Error describes which part of a SoundFont file failed to decode.
+type Error struct {
+	Chunk string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Chunk == "" {
+		return fmt.Sprintf("soundfont: %v", e.Err)
+	}
+	return fmt.Sprintf("soundfont: %s: %v", e.Chunk, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// SoundFont holds the presets and sample data of a SoundFont 2 file.
+type SoundFont struct {
+	Name    string
+	Presets []*Preset
+
+	// samples is the whole sample chunk, which Sample offsets point into.
+	samples []int16
+	// presets finds a preset by bank and program.
+	presets map[[2]int]*Preset
+}
+
+// Preset is an instrument as MIDI programs pick it: General MIDI sound
+// fonts put melodic instruments in bank 0 and drum kits in bank 128.
+type Preset struct {
+	Name    string
+	Bank    int
+	Program int
+
+	zones []zone
+}
+
+// Instrument is a set of samples, each played over a range of keys and
+// velocities.
+type Instrument struct {
+	Name string
+
+	zones []zone
+}
+
+// Sample is a recording in the sample chunk. Offsets count samples from
+// the start of the chunk, End and LoopEnd being past the last sample.
+type Sample struct {
+	Name            string
+	Start           int
+	End             int
+	LoopStart       int
+	LoopEnd         int
+	SampleRate      int
+	OriginalPitch   int
+	PitchCorrection int
+}
+
+// zone holds the generators of one part of a preset or instrument, with
+// the instrument or sample it plays.
+type zone struct {
+	generators generators
+	instrument *Instrument
+	sample     *Sample
+}
+
+// Load reads the SoundFont 2 file at path.
+func Load(path string) (*SoundFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Preset returns the preset of a bank and program. Missing presets fall
+// back on the same program in bank 0, or the drum kit of bank 128 for
+// other drum banks, then on the first preset of the bank and of the file.
+func (sf *SoundFont) Preset(bank, program int) *Preset {
+	if p, exists := sf.presets[[2]int{bank, program}]; exists {
+		return p
+	}
+	var fallbackBank = 0
+	if bank >= 128 {
+		fallbackBank = 128
+	}
+	if p, exists := sf.presets[[2]int{fallbackBank, program}]; exists {
+		return p
+	}
+	if p, exists := sf.presets[[2]int{fallbackBank, 0}]; exists {
+		return p
+	}
+	if len(sf.Presets) == 0 {
+		return nil
+	}
+	return sf.Presets[0]
+}
+
+// chunk is a RIFF chunk, or the contents of a LIST with its type.
+type chunk struct {
+	id   string
+	data []byte
+}
+
+// readChunks splits data into the chunks it holds.
+func readChunks(data []byte) ([]chunk, error) {
+	var chunks = []chunk{}
+	for len(data) >= 8 {
+		var id = string(data[:4])
+		var size = int(binary.LittleEndian.Uint32(data[4:8]))
+		data = data[8:]
+		if size > len(data) {
+			return nil, &Error{Chunk: id, Err: ErrChunkSize}
+		}
+		chunks = append(chunks, chunk{id: id, data: data[:size]})
+		// Chunks are padded to an even size.
+		data = data[min(size+size%2, len(data)):]
+	}
+	return chunks, nil
+}
+
+// readList returns the chunks of the LIST chunk of the given type.
+func readList(chunks []chunk, listType string) ([]chunk, error) {
+	for _, c := range chunks {
+		if c.id == "LIST" && len(c.data) >= 4 && string(c.data[:4]) == listType {
+			return readChunks(c.data[4:])
+		}
+	}
+	return nil, &Error{Chunk: listType, Err: ErrMissingChunk}
+}
+
+func findChunk(chunks []chunk, id string) ([]byte, error) {
+	for _, c := range chunks {
+		if c.id == id {
+			return c.data, nil
+		}
+	}
+	return nil, &Error{Chunk: id, Err: ErrMissingChunk}
+}
+
+// readName decodes a zero padded name.
+func readName(data []byte) string {
+	var name = string(data)
+	if i := strings.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSpace(name)
+}
+
+// Parse decodes a SoundFont 2 file.
+func Parse(data []byte) (*SoundFont, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return nil, &Error{Err: ErrNotSoundFont}
+	}
+	// The RIFF size counts the form type, which the header check read.
+	var riffSize = int(binary.LittleEndian.Uint32(data[4:8]))
+	if riffSize < 4 {
+		return nil, &Error{Chunk: "RIFF", Err: ErrChunkSize}
+	}
+	riff, err := readChunks(data[12:min(len(data), 8+riffSize)])
+	if err != nil {
+		return nil, err
+	}
+
+	var sf = &SoundFont{presets: map[[2]int]*Preset{}}
+	if info, err := readList(riff, "INFO"); err == nil {
+		if name, err := findChunk(info, "INAM"); err == nil {
+			sf.Name = readName(name)
+		}
+	}
+
+	sdta, err := readList(riff, "sdta")
+	if err != nil {
+		return nil, err
+	}
+	smpl, err := findChunk(sdta, "smpl")
+	if err != nil {
+		return nil, err
+	}
+	sf.samples = make([]int16, len(smpl)/2)
+	for i := range sf.samples {
+		sf.samples[i] = int16(binary.LittleEndian.Uint16(smpl[i*2:]))
+	}
+
+	pdta, err := readList(riff, "pdta")
+	if err != nil {
+		return nil, err
+	}
+	if err := sf.readPresets(pdta); err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// readRecords splits a pdta chunk into its fixed size records, the last one
+// being the terminal record closing the list, which bounds the one before.
+func readRecords(pdta []chunk, id string, size int) ([][]byte, error) {
+	data, err := findChunk(pdta, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%size != 0 || len(data) < size {
+		return nil, &Error{Chunk: id, Err: ErrChunkSize}
+	}
+	var records = make([][]byte, len(data)/size)
+	for i := range records {
+		records[i] = data[i*size : (i+1)*size]
+	}
+	return records, nil
+}
+
+// readBags reads the bag records, each pointing at its first generator.
+func readBags(pdta []chunk, id string) ([]int, error) {
+	records, err := readRecords(pdta, id, 4)
+	if err != nil {
+		return nil, err
+	}
+	var bags = make([]int, len(records))
+	for i, record := range records {
+		bags[i] = int(binary.LittleEndian.Uint16(record))
+	}
+	return bags, nil
+}
+
+// readGenerators reads the generator records as their operator and amount.
+func readGenerators(pdta []chunk, id string) ([]generator, error) {
+	records, err := readRecords(pdta, id, 4)
+	if err != nil {
+		return nil, err
+	}
+	var gens = make([]generator, len(records))
+	for i, record := range records {
+		gens[i] = generator{
+			operator: binary.LittleEndian.Uint16(record),
+			amount:   int16(binary.LittleEndian.Uint16(record[2:])),
+		}
+	}
+	return gens, nil
+}
+
+// readZones gathers the generators of the bags from first to last, both
+// included, into zones starting from base. linkOperator is the generator
+// naming the instrument or sample of a zone; a first zone without one is
+// the global zone, whose generators the others start from.
+func readZones(bags []int, gens []generator, first, last int, base generators, linkOperator uint16, chunkID string) ([]zone, error) {
+	if first < 0 || last >= len(bags)-1 || first > last+1 {
+		return nil, &Error{Chunk: chunkID, Err: ErrBadIndex}
+	}
+	var global = base
+	var zones = []zone{}
+	for bag := first; bag <= last; bag++ {
+		var start, end = bags[bag], bags[bag+1]
+		if start > end || end > len(gens) {
+			return nil, &Error{Chunk: chunkID, Err: ErrBadIndex}
+		}
+		var zoneGens = gens[start:end]
+		var linked = len(zoneGens) > 0 && zoneGens[len(zoneGens)-1].operator == linkOperator
+		if !linked {
+			if bag == first {
+				for _, g := range zoneGens {
+					global.set(g)
+				}
+			}
+			// Other zones without an instrument or sample are ignored.
+			continue
+		}
+		var z = zone{generators: global}
+		for _, g := range zoneGens {
+			z.generators.set(g)
+		}
+		zones = append(zones, z)
+	}
+	return zones, nil
+}
+
+func (sf *SoundFont) readPresets(pdta []chunk) error {
+	shdr, err := readRecords(pdta, "shdr", 46)
+	if err != nil {
+		return err
+	}
+	var samples = make([]*Sample, len(shdr)-1)
+	for i := range samples {
+		var record = shdr[i]
+		samples[i] = &Sample{
+			Name:            readName(record[:20]),
+			Start:           int(binary.LittleEndian.Uint32(record[20:])),
+			End:             int(binary.LittleEndian.Uint32(record[24:])),
+			LoopStart:       int(binary.LittleEndian.Uint32(record[28:])),
+			LoopEnd:         int(binary.LittleEndian.Uint32(record[32:])),
+			SampleRate:      int(binary.LittleEndian.Uint32(record[36:])),
+			OriginalPitch:   int(record[40]),
+			PitchCorrection: int(int8(record[41])),
+		}
+	}
+
+	inst, err := readRecords(pdta, "inst", 22)
+	if err != nil {
+		return err
+	}
+	ibag, err := readBags(pdta, "ibag")
+	if err != nil {
+		return err
+	}
+	igen, err := readGenerators(pdta, "igen")
+	if err != nil {
+		return err
+	}
+	var instruments = make([]*Instrument, len(inst)-1)
+	for i := range instruments {
+		var first = int(binary.LittleEndian.Uint16(inst[i][20:]))
+		var next = int(binary.LittleEndian.Uint16(inst[i+1][20:]))
+		zones, err := readZones(ibag, igen, first, next-1, defaultGenerators(), genSampleID, "ibag")
+		if err != nil {
+			return err
+		}
+		for j := range zones {
+			var sampleIndex = zones[j].generators.index(genSampleID)
+			if sampleIndex >= len(samples) {
+				return &Error{Chunk: "igen", Err: ErrBadIndex}
+			}
+			zones[j].sample = samples[sampleIndex]
+		}
+		instruments[i] = &Instrument{Name: readName(inst[i][:20]), zones: zones}
+	}
+
+	phdr, err := readRecords(pdta, "phdr", 38)
+	if err != nil {
+		return err
+	}
+	pbag, err := readBags(pdta, "pbag")
+	if err != nil {
+		return err
+	}
+	pgen, err := readGenerators(pdta, "pgen")
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(phdr)-1; i++ {
+		var first = int(binary.LittleEndian.Uint16(phdr[i][24:]))
+		var next = int(binary.LittleEndian.Uint16(phdr[i+1][24:]))
+		// Preset generators add to the instrument's, so they start from 0.
+		zones, err := readZones(pbag, pgen, first, next-1, presetBaseGenerators(), genInstrument, "pbag")
+		if err != nil {
+			return err
+		}
+		for j := range zones {
+			var instrumentIndex = zones[j].generators.index(genInstrument)
+			if instrumentIndex >= len(instruments) {
+				return &Error{Chunk: "pgen", Err: ErrBadIndex}
+			}
+			zones[j].instrument = instruments[instrumentIndex]
+		}
+		var preset = &Preset{
+			Name:    readName(phdr[i][:20]),
+			Program: int(binary.LittleEndian.Uint16(phdr[i][20:])),
+			Bank:    int(binary.LittleEndian.Uint16(phdr[i][22:])),
+			zones:   zones,
+		}
+		sf.Presets = append(sf.Presets, preset)
+		if _, exists := sf.presets[[2]int{preset.Bank, preset.Program}]; !exists {
+			sf.presets[[2]int{preset.Bank, preset.Program}] = preset
+		}
+	}
+	return nil
+}
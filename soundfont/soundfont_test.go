@@ -0,0 +1,240 @@
+package soundfont
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"piano-video/midiparser"
+)
+
+// riffChunk encodes a chunk, padded to an even size.
+func riffChunk(id string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	if len(data)%2 == 1 {
+		b.WriteByte(0)
+	}
+	return b.Bytes()
+}
+
+func riffList(listType string, chunks ...[]byte) []byte {
+	return riffChunk("LIST", append([]byte(listType), bytes.Join(chunks, nil)...))
+}
+
+// littleEndian encodes values one after the other, names as 20 bytes.
+func littleEndian(values ...any) []byte {
+	var b bytes.Buffer
+	for _, value := range values {
+		if name, isName := value.(string); isName {
+			var padded [20]byte
+			copy(padded[:], name)
+			value = padded
+		}
+		binary.Write(&b, binary.LittleEndian, value)
+	}
+	return b.Bytes()
+}
+
+// pdtaChunks lists the chunks of the pdta list in the order of the files.
+var pdtaChunks = []string{"phdr", "pbag", "pmod", "pgen", "inst", "ibag", "imod", "igen", "shdr"}
+
+// testSoundFontChunks returns the chunks of a sound font with a sine wave
+// sample, one instrument playing it, and a piano preset in bank 0 and a
+// drum kit in bank 128, both using the instrument.
+func testSoundFontChunks() map[string][]byte {
+	var smpl bytes.Buffer
+	for i := 0; i < 4000+46; i++ {
+		var value int16
+		if i < 4000 {
+			value = int16(12000 * math.Sin(2*math.Pi*float64(i)/100))
+		}
+		binary.Write(&smpl, binary.LittleEndian, value)
+	}
+	return map[string][]byte{
+		"INAM": []byte("Test\x00\x00"),
+		"smpl": smpl.Bytes(),
+		"phdr": littleEndian(
+			"Piano", uint16(0), uint16(0), uint16(0), [3]uint32{},
+			"Drums", uint16(0), uint16(128), uint16(1), [3]uint32{},
+			"EOP", uint16(0), uint16(0), uint16(2), [3]uint32{},
+		),
+		"pbag": littleEndian([]uint16{0, 0, 1, 0, 2, 0}),
+		"pmod": make([]byte, 10),
+		"pgen": littleEndian([]uint16{genInstrument, 0, genInstrument, 0, 0, 0}),
+		"inst": littleEndian("Sine", uint16(0), "EOI", uint16(2)),
+		// A global zone setting the release, then the sample's zone.
+		"ibag": littleEndian([]uint16{0, 0, 1, 0, 3, 0}),
+		"imod": make([]byte, 10),
+		"igen": littleEndian(
+			[]uint16{genReleaseVolEnv}, []int16{-2400},
+			[]uint16{genSampleModes, 1, genSampleID, 0, 0, 0},
+		),
+		"shdr": littleEndian(
+			"sine", []uint32{0, 4000, 1000, 3000, 44100}, []uint8{69, 0}, []uint16{0, 1},
+			"EOS", make([]byte, 26),
+		),
+	}
+}
+
+// soundFontFile assembles chunks into a file, leaving out missing ones.
+func soundFontFile(chunks map[string][]byte) []byte {
+	var pdta = [][]byte{}
+	for _, id := range pdtaChunks {
+		if data, exists := chunks[id]; exists {
+			pdta = append(pdta, riffChunk(id, data))
+		}
+	}
+	return riffChunk("RIFF", append([]byte("sfbk"), bytes.Join([][]byte{
+		riffList("INFO", riffChunk("INAM", chunks["INAM"])),
+		riffList("sdta", riffChunk("smpl", chunks["smpl"])),
+		riffList("pdta", pdta...),
+	}, nil)...))
+}
+
+func TestParse(t *testing.T) {
+	sf, err := Parse(soundFontFile(testSoundFontChunks()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.Name != "Test" || len(sf.Presets) != 2 {
+		t.Fatalf("Parse() = %q with %d presets, want \"Test\" with 2", sf.Name, len(sf.Presets))
+	}
+	var sample = sf.Presets[0].zones[0].instrument.zones[0].sample
+	if sample.Name != "sine" || sample.End != 4000 || sample.LoopStart != 1000 || sample.OriginalPitch != 69 {
+		t.Errorf("sample = %+v", sample)
+	}
+
+	var tests = []struct {
+		bank, program int
+		want          string
+	}{
+		{0, 0, "Piano"},
+		{128, 0, "Drums"},
+		{0, 40, "Piano"},
+		{8, 0, "Piano"},
+		{128, 25, "Drums"},
+		{129, 25, "Drums"},
+	}
+	for _, test := range tests {
+		if got := sf.Preset(test.bank, test.program); got.Name != test.want {
+			t.Errorf("Preset(%d, %d) = %q, want %q", test.bank, test.program, got.Name, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var valid = soundFontFile(testSoundFontChunks())
+	var smallRIFF = bytes.Clone(valid)
+	binary.LittleEndian.PutUint32(smallRIFF[4:], 2)
+
+	// with returns the test file with one chunk changed, or left out when
+	// data is nil.
+	var with = func(id string, data []byte) []byte {
+		var chunks = testSoundFontChunks()
+		if data == nil {
+			delete(chunks, id)
+		} else {
+			chunks[id] = data
+		}
+		return soundFontFile(chunks)
+	}
+
+	var tests = []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrNotSoundFont},
+		{"short", valid[:10], ErrNotSoundFont},
+		{"not a sound font", append([]byte("RIFF\x04\x00\x00\x00WAVE"), valid[12:]...), ErrNotSoundFont},
+		{"RIFF size too small", smallRIFF, ErrChunkSize},
+		{"truncated", valid[:len(valid)-100], ErrChunkSize},
+		{"missing chunk", with("shdr", nil), ErrMissingChunk},
+		{"record size", with("inst", make([]byte, 23)), ErrChunkSize},
+		{"bag past the generators", with("ibag", littleEndian([]uint16{0, 0, 9, 0, 9, 0})), ErrBadIndex},
+		{"preset bags past the list", with("phdr", littleEndian("Piano", uint16(0), uint16(0), uint16(0), [3]uint32{}, "EOP", uint16(0), uint16(0), uint16(7), [3]uint32{})), ErrBadIndex},
+		{"missing instrument", with("pgen", littleEndian([]uint16{genInstrument, 5, genInstrument, 0, 0, 0})), ErrBadIndex},
+		{"missing sample", with("igen", littleEndian([]uint16{genSampleID, 3, 0, 0})), ErrBadIndex},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.data)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, test.err)
+			}
+			var sfErr *Error
+			if !errors.As(err, &sfErr) {
+				t.Errorf("Parse() error = %T, want *Error", err)
+			}
+		})
+	}
+}
+
+func TestSynthesize(t *testing.T) {
+	sf, err := Parse(soundFontFile(testSoundFontChunks()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A4, the sample's pitch, held for a second at 120 bpm.
+	var midi = midiparser.ParsedMidi{
+		Meta: midiparser.HeaderMeta{QuarterValue: 96},
+		Tracks: []midiparser.Track{{Events: []midiparser.Event{
+			{Note: 69, Velocity: 100, OnTick: 0, Offtick: 192},
+		}}},
+	}
+	const sampleRate = 44100
+	out, err := sf.Synthesize(context.Background(), midi, sampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seconds = float64(len(out)/2) / sampleRate
+	if seconds < 1 || seconds > 1+maxTailSec {
+		t.Errorf("Synthesize() gave %.2fs, want the second of the note and its release", seconds)
+	}
+	var peak float32
+	for _, sample := range out[:sampleRate] {
+		peak = max(peak, sample, -sample)
+	}
+	if peak < 0.01 || peak > 1 {
+		t.Errorf("peak of the note = %g, want a sound within -1 to 1", peak)
+	}
+
+	again, err := sf.Synthesize(context.Background(), midi, sampleRate)
+	if err != nil || !slices.Equal(out, again) {
+		t.Errorf("Synthesize() changed between two runs")
+	}
+
+	// A note starting and ending on the same tick is released at once, so
+	// only its release rings, well before the second note at 2s.
+	var zeroLength = midiparser.ParsedMidi{
+		Meta: midiparser.HeaderMeta{QuarterValue: 96},
+		Tracks: []midiparser.Track{{Events: []midiparser.Event{
+			{Note: 69, Velocity: 100, OnTick: 0, Offtick: 0},
+			{Note: 69, Velocity: 100, OnTick: 384, Offtick: 480},
+		}}},
+	}
+	out, err = sf.Synthesize(context.Background(), zeroLength, sampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peak = 0
+	for _, sample := range out[2*sampleRate : 4*sampleRate] {
+		peak = max(peak, sample, -sample)
+	}
+	if peak > 0.001 {
+		t.Errorf("peak of a zero length note after 1s = %g, want it released", peak)
+	}
+
+	var canceled, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := sf.Synthesize(canceled, midi, sampleRate); !errors.Is(err, context.Canceled) {
+		t.Errorf("Synthesize() of a canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
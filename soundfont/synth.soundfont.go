@@ -0,0 +1,357 @@
+package soundfont
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"piano-video/midiparser"
+)
+
+// maxVoices bounds how many voices play at once; the oldest are dropped
+// beyond it.
+const maxVoices = 256
+
+// maxTailSec bounds how long the sound can ring after the last event.
+const maxTailSec = 10
+
+// Controllers the synthesizer follows, besides midiparser.ControllerSustain.
+const (
+	controllerBankSelect       = 0
+	controllerDataEntry        = 6
+	controllerVolume           = 7
+	controllerPan              = 10
+	controllerExpression       = 11
+	controllerDataEntryLSB     = 38
+	controllerRPNLSB           = 100
+	controllerRPNMSB           = 101
+	controllerAllSoundOff      = 120
+	controllerResetControllers = 121
+	controllerAllNotesOff      = 123
+)
+
+// eventKind orders the events of a tick: notes end before others start,
+// and the channel is set up before the notes starting with it. Notes
+// starting and ending on the same tick end last, once they started.
+type eventKind int
+
+const (
+	eventNoteOff eventKind = iota
+	eventProgram
+	eventControl
+	eventPitchBend
+	eventNoteOn
+	eventShortNoteOff
+)
+
+type event struct {
+	tick    int
+	kind    eventKind
+	channel byte
+
+	noteID   int
+	key      int
+	velocity int
+
+	controller byte
+	value      int
+}
+
+// controlRank orders the control changes of a tick so that bank and
+// parameter selections come before the data entries they apply to.
+func controlRank(controller byte) int {
+	switch controller {
+	case controllerBankSelect, 32, 98, 99, controllerRPNLSB, controllerRPNMSB:
+		return 0
+	case controllerDataEntry, controllerDataEntryLSB:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// midiEvents lists the events of midi the synthesizer plays, in order.
+// Channels and controllers are walked in order so that the result does not
+// depend on map iteration.
+func midiEvents(midi midiparser.ParsedMidi) []event {
+	var events = []event{}
+	var noteID = 0
+	for _, track := range midi.Tracks {
+		for _, note := range track.Events {
+			if note.Velocity == 0 {
+				continue
+			}
+			var offKind = eventNoteOff
+			if note.Offtick <= note.OnTick {
+				offKind = eventShortNoteOff
+			}
+			events = append(events,
+				event{tick: note.OnTick, kind: eventNoteOn, channel: note.Channel, noteID: noteID, key: note.Note, velocity: note.Velocity},
+				event{tick: max(note.Offtick, note.OnTick), kind: offKind, channel: note.Channel, noteID: noteID},
+			)
+			noteID++
+		}
+	}
+	for channel := 0; channel < 16; channel++ {
+		for _, change := range midi.ProgramChanges[byte(channel)] {
+			events = append(events, event{tick: change.OnTick, kind: eventProgram, channel: byte(channel), value: int(change.Patch)})
+		}
+		for _, bend := range midi.PitchBends[byte(channel)] {
+			events = append(events, event{tick: bend.OnTick, kind: eventPitchBend, channel: byte(channel), value: bend.Value})
+		}
+		for controller := 0; controller < 128; controller++ {
+			for _, change := range midi.ControlChanges[byte(channel)][byte(controller)] {
+				events = append(events, event{tick: change.OnTick, kind: eventControl, channel: byte(channel), controller: byte(controller), value: int(change.Value)})
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		var a, b = events[i], events[j]
+		if a.tick != b.tick {
+			return a.tick < b.tick
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.kind == eventControl && controlRank(a.controller) < controlRank(b.controller)
+	})
+	return events
+}
+
+// channelState holds what the controllers of a channel are set to.
+type channelState struct {
+	program    int
+	bank       int
+	volume     int
+	expression int
+	pan        int
+	sustain    bool
+
+	// bend is the pitch bend in semitones, within bendRange.
+	bend      float64
+	bendRange float64
+	rpn       [2]int
+}
+
+func newChannelState() channelState {
+	var c = channelState{volume: 100, pan: 64}
+	c.resetControllers()
+	return c
+}
+
+// resetControllers does what controller 121 asks for, leaving volume, pan
+// and the program alone.
+func (c *channelState) resetControllers() {
+	c.expression = 127
+	c.sustain = false
+	c.bend = 0
+	c.bendRange = 2
+	c.rpn = [2]int{127, 127}
+}
+
+func (c *channelState) gain() float64 {
+	var volume = float64(c.volume) / 127
+	var expression = float64(c.expression) / 127
+	return volume * volume * expression * expression
+}
+
+// synth plays events into a buffer of interleaved stereo samples.
+type synth struct {
+	sf         *SoundFont
+	sampleRate int
+	channels   [16]channelState
+	voices     []*voice
+	out        []float32
+}
+
+// render plays the voices until frame, a number of stereo samples from the
+// start.
+func (s *synth) render(frame int) {
+	if frame*2 <= len(s.out) {
+		return
+	}
+	var start = len(s.out)
+	s.out = append(s.out, make([]float32, frame*2-start)...)
+	var playing = s.voices[:0]
+	for _, v := range s.voices {
+		var channel = &s.channels[v.channel]
+		v.mix(s.out[start:], channel.gain(), float64(channel.pan-64)/127)
+		if !v.finished() {
+			playing = append(playing, v)
+		}
+	}
+	clear(s.voices[len(playing):])
+	s.voices = playing
+}
+
+func (s *synth) noteOn(e event) {
+	var channel = &s.channels[e.channel]
+	var bank = channel.bank
+	if midiparser.IsPercussionChannel(e.channel) {
+		bank = 128
+	}
+	var preset = s.sf.Preset(bank, channel.program)
+	if preset == nil {
+		return
+	}
+	for _, r := range preset.regions(e.key, e.velocity) {
+		var v = newVoice(s.sf, r, int(e.channel), e.noteID, e.key, e.velocity, s.sampleRate)
+		v.setPitchBend(channel.bend)
+		if v.exclusiveClass != 0 {
+			for _, other := range s.voices {
+				if other.channel == v.channel && other.exclusiveClass == v.exclusiveClass {
+					other.envelope.stage = stageFinished
+				}
+			}
+		}
+		if len(s.voices) >= maxVoices {
+			s.voices = append(s.voices[:0], s.voices[1:]...)
+		}
+		s.voices = append(s.voices, v)
+	}
+}
+
+func (s *synth) noteOff(e event) {
+	var sustain = s.channels[e.channel].sustain
+	for _, v := range s.voices {
+		if v.noteID != e.noteID || v.released {
+			continue
+		}
+		if sustain {
+			v.sustained = true
+		} else {
+			v.release()
+		}
+	}
+}
+
+// releaseChannel releases the notes of a channel, those held by the pedal
+// only or all of them.
+func (s *synth) releaseChannel(channel int, sustainedOnly bool) {
+	for _, v := range s.voices {
+		if v.channel == channel && (v.sustained || !sustainedOnly) {
+			v.release()
+		}
+	}
+}
+
+func (s *synth) setPitchBend(channel int) {
+	for _, v := range s.voices {
+		if v.channel == channel {
+			v.setPitchBend(s.channels[channel].bend)
+		}
+	}
+}
+
+func (s *synth) controlChange(e event) {
+	var channel = &s.channels[e.channel]
+	switch e.controller {
+	case controllerBankSelect:
+		channel.bank = e.value
+	case controllerVolume:
+		channel.volume = e.value
+	case controllerPan:
+		channel.pan = e.value
+	case controllerExpression:
+		channel.expression = e.value
+	case midiparser.ControllerSustain:
+		channel.sustain = midiparser.IsPedalDown(byte(e.value))
+		if !channel.sustain {
+			s.releaseChannel(int(e.channel), true)
+		}
+	case controllerRPNMSB:
+		channel.rpn[0] = e.value
+	case controllerRPNLSB:
+		channel.rpn[1] = e.value
+	case controllerDataEntry:
+		// RPN 0 is the pitch bend range, in semitones then cents.
+		if channel.rpn == [2]int{0, 0} {
+			channel.bendRange = float64(e.value) + math.Mod(channel.bendRange, 1)
+		}
+	case controllerDataEntryLSB:
+		if channel.rpn == [2]int{0, 0} {
+			channel.bendRange = math.Floor(channel.bendRange) + float64(e.value)/100
+		}
+	case controllerAllSoundOff:
+		for _, v := range s.voices {
+			if v.channel == int(e.channel) {
+				v.envelope.stage = stageFinished
+			}
+		}
+	case controllerResetControllers:
+		channel.resetControllers()
+		s.releaseChannel(int(e.channel), true)
+		s.setPitchBend(int(e.channel))
+	case controllerAllNotesOff:
+		s.releaseChannel(int(e.channel), false)
+	}
+}
+
+func (s *synth) play(e event) {
+	var channel = &s.channels[e.channel]
+	switch e.kind {
+	case eventNoteOn:
+		s.noteOn(e)
+	case eventNoteOff, eventShortNoteOff:
+		s.noteOff(e)
+	case eventProgram:
+		channel.program = e.value
+	case eventControl:
+		s.controlChange(e)
+	case eventPitchBend:
+		channel.bend = float64(e.value) / 8192 * channel.bendRange
+		s.setPitchBend(int(e.channel))
+	}
+}
+
+// Synthesize plays midi with the presets of the sound font and returns the
+// interleaved stereo samples at sampleRate, from -1 to 1. Notes left
+// ringing at the end are released and their tail kept, up to 10 seconds.
+// The result only depends on its arguments. Canceling ctx stops it.
+func (sf *SoundFont) Synthesize(ctx context.Context, midi midiparser.ParsedMidi, sampleRate int) ([]float32, error) {
+	var s = &synth{sf: sf, sampleRate: sampleRate}
+	for i := range s.channels {
+		s.channels[i] = newChannelState()
+	}
+	var tempoMap = midi.Meta.TempoMap()
+	var frameAt = func(tick int) int {
+		return int(math.Round(tempoMap.Seconds(tick) * float64(sampleRate)))
+	}
+
+	for _, e := range midiEvents(midi) {
+		if err := ctx.Err(); err != nil {
+			return nil, context.Cause(ctx)
+		}
+		s.render(frameAt(e.tick))
+		s.play(e)
+	}
+	s.render(frameAt(midi.LastTick()))
+
+	for i := range s.channels {
+		s.releaseChannel(i, false)
+	}
+	var tailEnd = len(s.out)/2 + maxTailSec*sampleRate
+	for len(s.voices) > 0 && len(s.out)/2 < tailEnd {
+		if err := ctx.Err(); err != nil {
+			return nil, context.Cause(ctx)
+		}
+		s.render(min(len(s.out)/2+sampleRate/10, tailEnd))
+	}
+
+	normalize(s.out)
+	return s.out, nil
+}
+
+// normalize scales samples down to fit from -1 to 1 if they don't.
+func normalize(samples []float32) {
+	var peak float32 = 0
+	for _, sample := range samples {
+		peak = max(peak, sample, -sample)
+	}
+	if peak <= 1 {
+		return
+	}
+	for i := range samples {
+		samples[i] /= peak
+	}
+}
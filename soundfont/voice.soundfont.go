@@ -0,0 +1,278 @@
+package soundfont
+
+import "math"
+
+// region is a sample a preset plays for a key and velocity, with the
+// generators of the preset and instrument zones added up.
+type region struct {
+	sample     *Sample
+	generators [genCount]int
+}
+
+// regions returns what the preset plays for a key and velocity; layered
+// presets play several samples at once.
+func (p *Preset) regions(key, velocity int) []region {
+	var regions = []region{}
+	for _, pz := range p.zones {
+		if !pz.generators.inRange(genKeyRange, key) || !pz.generators.inRange(genVelRange, velocity) {
+			continue
+		}
+		for _, iz := range pz.instrument.zones {
+			if !iz.generators.inRange(genKeyRange, key) || !iz.generators.inRange(genVelRange, velocity) {
+				continue
+			}
+			regions = append(regions, region{sample: iz.sample, generators: iz.generators.plus(pz.generators)})
+		}
+	}
+	return regions
+}
+
+// timecentsToSamples converts an envelope time, in timecents, to a number
+// of samples. The lowest times the specification allows are instants.
+func timecentsToSamples(timecents float64, sampleRate int) int {
+	if timecents <= -12000 {
+		return 0
+	}
+	return int(math.Pow(2, timecents/1200) * float64(sampleRate))
+}
+
+// centibelsToGain converts an attenuation to an amplitude factor.
+func centibelsToGain(centibels float64) float64 {
+	return math.Pow(10, -centibels/200)
+}
+
+// silence is the attenuation, in centibels, at which a decaying or
+// released voice counts as silent, and the one envelope rates refer to.
+const silence = 960
+
+type envelopeStage int
+
+const (
+	stageDelay envelopeStage = iota
+	stageAttack
+	stageHold
+	stageDecay
+	stageSustain
+	stageRelease
+	stageFinished
+)
+
+// envelope is the volume envelope of a voice. The attack rises linearly,
+// decay and release fall by a constant number of decibels per sample.
+type envelope struct {
+	stage     envelopeStage
+	level     float64
+	remaining int
+
+	attackStep    float64
+	holdSamples   int
+	decayFactor   float64
+	sustainLevel  float64
+	releaseFactor float64
+}
+
+// fallFactor is the factor applied to the level at each sample to fall to
+// silence in the given number of samples.
+func fallFactor(samples int) float64 {
+	if samples <= 0 {
+		return 0
+	}
+	return math.Pow(centibelsToGain(silence), 1/float64(samples))
+}
+
+func newEnvelope(g [genCount]int, key int, sampleRate int) envelope {
+	var attack = timecentsToSamples(float64(g[genAttackVolEnv]), sampleRate)
+	var hold = timecentsToSamples(float64(g[genHoldVolEnv]+g[genKeynumToVolEnvHold]*(60-key)), sampleRate)
+	var decay = timecentsToSamples(float64(g[genDecayVolEnv]+g[genKeynumToVolEnvDecay]*(60-key)), sampleRate)
+	var release = timecentsToSamples(float64(g[genReleaseVolEnv]), sampleRate)
+
+	var e = envelope{
+		stage:         stageDelay,
+		remaining:     timecentsToSamples(float64(g[genDelayVolEnv]), sampleRate),
+		attackStep:    1 / float64(max(attack, 1)),
+		holdSamples:   hold,
+		decayFactor:   fallFactor(decay),
+		sustainLevel:  centibelsToGain(float64(min(max(g[genSustainVolEnv], 0), 1440))),
+		releaseFactor: fallFactor(release),
+	}
+	if attack == 0 {
+		e.attackStep = 1
+	}
+	return e
+}
+
+// next returns the level of the envelope at the next sample.
+func (e *envelope) next() float64 {
+	switch e.stage {
+	case stageDelay:
+		if e.remaining > 0 {
+			e.remaining--
+			return 0
+		}
+		e.stage = stageAttack
+		return e.next()
+	case stageAttack:
+		e.level += e.attackStep
+		if e.level >= 1 {
+			e.level = 1
+			e.stage = stageHold
+			e.remaining = e.holdSamples
+		}
+	case stageHold:
+		if e.remaining > 0 {
+			e.remaining--
+		} else {
+			e.stage = stageDecay
+		}
+	case stageDecay:
+		e.level *= e.decayFactor
+		if e.level <= e.sustainLevel {
+			e.level = e.sustainLevel
+			e.stage = stageSustain
+		}
+	case stageRelease:
+		e.level *= e.releaseFactor
+		if e.level <= centibelsToGain(silence) {
+			e.level = 0
+			e.stage = stageFinished
+		}
+	}
+	return e.level
+}
+
+func (e *envelope) release() {
+	if e.stage != stageFinished {
+		e.stage = stageRelease
+	}
+}
+
+// voice plays one region of a note.
+type voice struct {
+	channel        int
+	noteID         int
+	exclusiveClass int
+
+	data      []int16
+	position  float64
+	end       int
+	loopStart int
+	loopEnd   int
+	loopMode  int
+
+	// pitchCents is the pitch of the voice relative to the sample's, before
+	// pitch bend; rateRatio corrects for the sample's rate.
+	pitchCents float64
+	rateRatio  float64
+	step       float64
+
+	gain     float64
+	pan      float64
+	envelope envelope
+
+	released  bool
+	sustained bool
+}
+
+func newVoice(sf *SoundFont, r region, channel, noteID, key, velocity, sampleRate int) *voice {
+	var g = r.generators
+	var sample = r.sample
+
+	if g[genKeynum] >= 0 {
+		key = g[genKeynum]
+	}
+	if g[genVelocity] >= 0 {
+		velocity = g[genVelocity]
+	}
+	var rootKey = sample.OriginalPitch
+	if g[genOverridingRootKey] >= 0 {
+		rootKey = g[genOverridingRootKey]
+	}
+
+	var v = &voice{
+		channel:        channel,
+		noteID:         noteID,
+		exclusiveClass: g[genExclusiveClass],
+
+		data:      sf.samples,
+		position:  float64(sample.Start + g[genStartAddrsOffset] + g[genStartAddrsCoarseOffset]*32768),
+		end:       sample.End + g[genEndAddrsOffset] + g[genEndAddrsCoarseOffset]*32768,
+		loopStart: sample.LoopStart + g[genStartloopAddrsOffset] + g[genStartloopAddrsCoarseOffset]*32768,
+		loopEnd:   sample.LoopEnd + g[genEndloopAddrsOffset] + g[genEndloopAddrsCoarseOffset]*32768,
+		loopMode:  g[genSampleModes] & 3,
+
+		pitchCents: float64((key-rootKey)*g[genScaleTuning]+g[genCoarseTune]*100+g[genFineTune]) + float64(sample.PitchCorrection),
+		rateRatio:  float64(sample.SampleRate) / float64(sampleRate),
+
+		pan:      float64(min(max(g[genPan], -500), 500)) / 1000,
+		envelope: newEnvelope(g, key, sampleRate),
+	}
+	// Like most synthesizers, only 40% of the attenuation is applied, as
+	// the sound fonts made for the original hardware expect.
+	var velocityGain = float64(velocity) / 127
+	v.gain = velocityGain * velocityGain * centibelsToGain(0.4*float64(max(g[genInitialAttenuation], 0)))
+
+	v.end = min(max(v.end, 0), len(v.data))
+	v.position = min(max(v.position, 0), float64(v.end))
+	if v.loopStart < int(v.position) || v.loopEnd > v.end || v.loopEnd-v.loopStart < 2 {
+		v.loopMode = sampleNoLoop
+	}
+	return v
+}
+
+// setPitchBend tunes the voice by bend semitones.
+func (v *voice) setPitchBend(semitones float64) {
+	v.step = math.Pow(2, (v.pitchCents+semitones*100)/1200) * v.rateRatio
+}
+
+// looping reports whether the voice goes back to its loop start at the end
+// of the loop.
+func (v *voice) looping() bool {
+	return v.loopMode == sampleLoop || (v.loopMode == sampleLoopUntilRelease && !v.released)
+}
+
+func (v *voice) release() {
+	v.released = true
+	v.sustained = false
+	v.envelope.release()
+}
+
+// finished reports whether the voice has nothing left to play.
+func (v *voice) finished() bool {
+	return v.envelope.stage == stageFinished || (!v.looping() && v.position >= float64(v.end-1))
+}
+
+// mix adds the voice to frames of interleaved stereo samples, at the
+// channel's gain and with its pan, from -0.5 for left to 0.5 for right,
+// added to the voice's.
+func (v *voice) mix(out []float32, gain, pan float64) {
+	var panAngle = min(max(v.pan+pan+0.5, 0), 1) * math.Pi / 2
+	var left = math.Cos(panAngle) * gain * v.gain / 32768
+	var right = math.Sin(panAngle) * gain * v.gain / 32768
+
+	for i := 0; i+1 < len(out); i += 2 {
+		if v.looping() {
+			for v.position >= float64(v.loopEnd) {
+				v.position -= float64(v.loopEnd - v.loopStart)
+			}
+		} else if v.position >= float64(v.end-1) {
+			v.envelope.stage = stageFinished
+			return
+		}
+
+		var index = int(v.position)
+		var fraction = v.position - float64(index)
+		var nextIndex = index + 1
+		if v.looping() && nextIndex >= v.loopEnd {
+			nextIndex = v.loopStart
+		}
+		var sample = float64(v.data[index])*(1-fraction) + float64(v.data[nextIndex])*fraction
+
+		var level = v.envelope.next()
+		if v.envelope.stage == stageFinished {
+			return
+		}
+		out[i] += float32(sample * level * left)
+		out[i+1] += float32(sample * level * right)
+		v.position += v.step
+	}
+}
@@ -0,0 +1,40 @@
+package soundfont
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// WriteWAV writes interleaved stereo samples, from -1 to 1, as a 16-bit
+// PCM WAV file.
+func WriteWAV(w io.Writer, samples []float32, sampleRate int) error {
+	const channels = 2
+	const bytesPerSample = 2
+	var dataSize = len(samples) * bytesPerSample
+
+	var out = bufio.NewWriter(w)
+	var header = []any{
+		[4]byte{'R', 'I', 'F', 'F'}, uint32(36 + dataSize), [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * bytesPerSample), uint16(channels * bytesPerSample), uint16(8 * bytesPerSample),
+		[4]byte{'d', 'a', 't', 'a'}, uint32(dataSize),
+	}
+	for _, field := range header {
+		if err := binary.Write(out, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	var buffer = make([]byte, bytesPerSample)
+	for _, sample := range samples {
+		var value = int16(math.Round(float64(min(max(sample, -1), 1)) * math.MaxInt16))
+		binary.LittleEndian.PutUint16(buffer, uint16(value))
+		if _, err := out.Write(buffer); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
@@ -1,29 +1,100 @@
 package videogenerator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+
+	"piano-video/soundfont"
 )
 
-func convertMidiToMp3(midiFilePath string) string {
-	var outputMp3Path = midiFilePath + ".wav"
+// AudioRenderer synthesizes a MIDI file into a WAV file. The WAV must start
+// where the MIDI file does, silence included, for the video to line up.
+type AudioRenderer interface {
+	RenderAudio(ctx context.Context, midiFilePath string, outputWavPath string) error
+}
+
+// Timidity synthesizes audio with the timidity command and its configured
+// sound fonts.
+type Timidity struct{}
+
+func (Timidity) RenderAudio(ctx context.Context, midiFilePath string, outputWavPath string) error {
 	timidityCmdArgs := []string{
 		midiFilePath, "-Ow",
 		"--preserve-silence",
-		"-o", outputMp3Path,
+		"-o", outputWavPath,
+	}
+
+	cmd := exec.CommandContext(ctx, "timidity", timidityCmdArgs...)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return commandError(ctx, "timidity", err, output)
+	}
+	return nil
+}
+
+// FluidSynth synthesizes audio with the fluidsynth command and the sound
+// font at SoundFontPath.
+type FluidSynth struct {
+	SoundFontPath string
+}
+
+func (f FluidSynth) RenderAudio(ctx context.Context, midiFilePath string, outputWavPath string) error {
+	fluidsynthCmdArgs := []string{
+		"-ni",
+		"-F", outputWavPath,
+		"-T", "wav",
+		"-r", strconv.Itoa(defaultSampleRate),
+		f.SoundFontPath, midiFilePath,
 	}
 
-	cmd := exec.Command("timidity", timidityCmdArgs...)
+	cmd := exec.CommandContext(ctx, "fluidsynth", fluidsynthCmdArgs...)
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error executing timidity command: %v\n", err)
-		return ""
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return commandError(ctx, "fluidsynth", err, output)
 	}
+	return nil
+}
 
-	return outputMp3Path
+// SoundFontSynth synthesizes audio in process from the sound font at
+// SoundFontPath, needing no other program. The same file and sound font
+// always give the same audio.
+type SoundFontSynth struct {
+	SoundFontPath string
+	// SampleRate defaults to 44100 Hz.
+	SampleRate int
 }
 
-func removeAudioFile(filePath string) {
-	os.Remove(filePath)
+const defaultSampleRate = 44100
+
+func (s SoundFontSynth) RenderAudio(ctx context.Context, midiFilePath string, outputWavPath string) error {
+	sf, err := soundfont.Load(s.SoundFontPath)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", s.SoundFontPath, err)
+	}
+	parsedMidi, err := parseMidiFile(midiFilePath)
+	if err != nil {
+		return err
+	}
+
+	var sampleRate = s.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = defaultSampleRate
+	}
+	samples, err := sf.Synthesize(ctx, parsedMidi, sampleRate)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(outputWavPath)
+	if err != nil {
+		return err
+	}
+	if err := soundfont.WriteWAV(f, samples, sampleRate); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	return f.Close()
 }
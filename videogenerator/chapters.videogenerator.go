@@ -0,0 +1,93 @@
+package videogenerator
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// getChapters turns the marker and cue point meta events into chapters
+// covering the whole video.
+func (s *song) getChapters() []Chapter {
+	var markers = append(s.midi.Markers(), s.midi.CuePoints()...)
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].OnTick < markers[j].OnTick
+	})
+
+	var chapters = []Chapter{}
+	for _, marker := range markers {
+		var title = strings.TrimSpace(marker.Text)
+		if title == "" {
+			continue
+		}
+		var start = s.getTickTime(marker.OnTick)
+		if len(chapters) == 0 {
+			start = 0
+		} else if start <= chapters[len(chapters)-1].Start {
+			continue
+		}
+		chapters = append(chapters, Chapter{Title: title, Start: start})
+	}
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		} else {
+			chapters[i].End = s.musicTime
+		}
+	}
+	return chapters
+}
+
+func escapeFFMetadata(value string) string {
+	var replacer = strings.NewReplacer("\\", "\\\\", "=", "\\=", ";", "\\;", "#", "\\#", "\n", "\\\n")
+	return replacer.Replace(value)
+}
+
+// writeFFMetadata writes the title and chapters in ffmpeg's metadata file
+// format, to be passed to ffmpeg as an extra input.
+func writeFFMetadata(path string, title string, chapters []Chapter) error {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	if title != "" {
+		fmt.Fprintf(&b, "title=%s\n", escapeFFMetadata(title))
+	}
+	for _, chapter := range chapters {
+		b.WriteString("[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&b, "START=%d\nEND=%d\n", int64(chapter.Start*1000), int64(chapter.End*1000))
+		fmt.Fprintf(&b, "title=%s\n", escapeFFMetadata(chapter.Title))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func formatSubtitleTime(seconds float64, decimalSeparator string) string {
+	var d = time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, decimalSeparator, d.Milliseconds()%1000)
+}
+
+func writeWebVTT(path string, chapters []Chapter) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, chapter := range chapters {
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1, formatSubtitleTime(chapter.Start, "."), formatSubtitleTime(chapter.End, "."), chapter.Title)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func writeSRT(path string, chapters []Chapter) error {
+	var b strings.Builder
+	for i, chapter := range chapters {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatSubtitleTime(chapter.Start, ","), formatSubtitleTime(chapter.End, ","), chapter.Title)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// writeChapterSidecars writes .vtt and .srt chapter files next to the video.
+func writeChapterSidecars(outputVideoPath string, chapters []Chapter) error {
+	var basePath = strings.TrimSuffix(outputVideoPath, ".mp4")
+	if err := writeWebVTT(basePath+".vtt", chapters); err != nil {
+		return err
+	}
+	return writeSRT(basePath+".srt", chapters)
+}
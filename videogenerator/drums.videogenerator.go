@@ -0,0 +1,103 @@
+package videogenerator
+
+import (
+	"piano-video/midiparser"
+	"slices"
+	"sort"
+
+	"github.com/fogleman/gg"
+)
+
+// drumPadFadeSec is how long a drum pad stays lit after it is hit.
+const drumPadFadeSec float64 = 0.3
+
+func (r *Renderer) isDrumChannel(channel byte) bool {
+	return midiparser.IsPercussionChannel(channel) || slices.Contains(r.config.DrumChannels, channel)
+}
+
+func (s *song) drumStripHeight() float64 {
+	if !s.config.ShowDrumStrip || len(s.drumPads) == 0 {
+		return 0
+	}
+	return s.drumStripH
+}
+
+func (s *song) setDrumHit(note int, time float64, velocity int) {
+	if _, exists := s.drumHits[note]; !exists {
+		s.drumPads = append(s.drumPads, note)
+	}
+	s.drumHits[note] = append(s.drumHits[note], DrumHit{Time: time, Velocity: velocity})
+}
+
+// sortDrumHits orders the pads by note and each pad's hits by time, since
+// hits are collected track by track.
+func (s *song) sortDrumHits() {
+	sort.Ints(s.drumPads)
+	for _, hits := range s.drumHits {
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].Time < hits[j].Time
+		})
+	}
+}
+
+// getDrumPadLevel returns how lit a pad is at time t, from 0 to 1.
+func (s *song) getDrumPadLevel(note int, t float64) float64 {
+	var hits = s.drumHits[note]
+	i := sort.Search(len(hits), func(i int) bool {
+		return hits[i].Time > t
+	})
+	if i == 0 {
+		return 0
+	}
+	var hit = hits[i-1]
+	var elapsed = t - hit.Time
+	if elapsed >= drumPadFadeSec {
+		return 0
+	}
+	return float64(hit.Velocity) / 127 * (1 - elapsed/drumPadFadeSec)
+}
+
+func getDrumPadName(note int) string {
+	if name := midiparser.PercussionName(note); name != "" {
+		return name
+	}
+	return midiparser.KeySignature{}.NoteName(note)
+}
+
+func (s *song) drawDrumStrip(dc *gg.Context, t float64) {
+	var stripH = s.drumStripHeight()
+	if stripH == 0 {
+		return
+	}
+	var stripW = float64(s.whiteKeysDisplayed) * s.keyW
+	var padding = stripH * 0.12
+	var padW = min(stripW/float64(len(s.drumPads)), s.keyW*5)
+	var stripX = (s.w - padW*float64(len(s.drumPads))) / 2
+
+	setRGBColor(dc, s.config.Theme.Panel)
+	dc.DrawRectangle(0, 0, s.w, stripH)
+	dc.Fill()
+
+	var fontSize = min(stripH*0.25, padW*0.16)
+	dc.SetFontFace(getFontFace(fontSize))
+	for i, note := range s.drumPads {
+		var x = stripX + float64(i)*padW + padding/2
+		var y = padding
+		var pw = padW - padding
+		var ph = stripH - 2*padding
+
+		setRGBColor(dc, s.config.Theme.Pad)
+		dc.DrawRoundedRectangle(x, y, pw, ph, ph/6)
+		dc.Fill()
+
+		if level := s.getDrumPadLevel(note, t); level > 0 {
+			var c = s.config.Theme.DrumPadColor
+			dc.SetRGBA(c.R, c.G, c.B, level)
+			dc.DrawRoundedRectangle(x, y, pw, ph, ph/6)
+			dc.Fill()
+		}
+
+		dc.SetRGBA(1, 1, 1, 0.85)
+		dc.DrawStringWrapped(getDrumPadName(note), x+pw/2, y+ph/2, 0.5, 0.5, pw*0.9, 1.1, gg.AlignCenter)
+	}
+}
@@ -0,0 +1,170 @@
+package videogenerator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os/exec"
+
+	"github.com/fogleman/gg"
+)
+
+// frame is a drawn frame on its way to the encoder. release hands its
+// drawing context back to the workers.
+type frame struct {
+	index   int
+	dc      *gg.Context
+	release func()
+}
+
+// frameEncoder streams raw RGBA frames to ffmpeg's standard input. Workers
+// finish frames out of order, so the ones drawn ahead wait in a reorder
+// buffer, which holds at most Config.Workers frames as each holds one of
+// the workers' drawing contexts.
+type frameEncoder struct {
+	ctx     context.Context
+	stop    context.CancelFunc
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	output  bytes.Buffer
+	frames  chan frame
+	written chan error
+}
+
+// startEncoder starts ffmpeg encoding the frames it will be given with put
+// and the audio into the video at outputPath. A failure to write frames
+// stops the drawing with cancelDraw.
+func (s *song) startEncoder(ctx context.Context, cancelDraw context.CancelCauseFunc, audioFilePath string, metadataPath string, outputPath string) (*frameEncoder, error) {
+	var videoInput = []string{
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", int(s.w), int(s.h)),
+		"-framerate", fmt.Sprintf("%d", s.config.FPS),
+		"-i", "pipe:0",
+	}
+
+	var e = &frameEncoder{
+		ctx:     ctx,
+		frames:  make(chan frame),
+		written: make(chan error, 1),
+	}
+	var encodeCtx context.Context
+	encodeCtx, e.stop = context.WithCancel(ctx)
+	e.cmd = exec.CommandContext(encodeCtx, "ffmpeg", s.ffmpegArgs(videoInput, audioFilePath, metadataPath, outputPath)...)
+	e.cmd.Stdout = &e.output
+	e.cmd.Stderr = &e.output
+
+	var err error
+	if e.stdin, err = e.cmd.StdinPipe(); err != nil {
+		e.stop()
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	if err := e.cmd.Start(); err != nil {
+		e.stop()
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	go e.writeFrames(cancelDraw)
+	return e, nil
+}
+
+// put is the frameSink of createFrames.
+func (e *frameEncoder) put(ctx context.Context, dc *gg.Context, i int, release func()) error {
+	select {
+	case e.frames <- frame{index: i, dc: dc, release: release}:
+		return nil
+	case <-ctx.Done():
+		release()
+		return ctx.Err()
+	}
+}
+
+// writeFrames writes the frames in order as they come. Once a write fails
+// it only releases them.
+func (e *frameEncoder) writeFrames(cancelDraw context.CancelCauseFunc) {
+	var pending = map[int]frame{}
+	var next = 0
+	var err error
+	for f := range e.frames {
+		pending[f.index] = f
+		for {
+			var f, ready = pending[next]
+			if !ready {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if err == nil {
+				if _, err = e.stdin.Write(framePixels(f.dc)); err != nil {
+					err = fmt.Errorf("writing frame %d: %w", f.index+1, err)
+					cancelDraw(err)
+				}
+			}
+			f.release()
+		}
+	}
+	// Frames drawn past a frame that never came, after a cancellation.
+	for _, f := range pending {
+		f.release()
+	}
+	e.written <- err
+}
+
+// framePixels returns the RGBA pixels of a frame, row after row.
+func framePixels(dc *gg.Context) []byte {
+	if rgba, ok := dc.Image().(*image.RGBA); ok && rgba.Stride == rgba.Rect.Dx()*4 {
+		return rgba.Pix
+	}
+	var bounds = dc.Image().Bounds()
+	var rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, dc.Image(), bounds.Min, draw.Src)
+	return rgba.Pix
+}
+
+// finish waits for ffmpeg to encode the frames given, drawErr being why
+// drawing them stopped early, if it did. The video is removed on failure.
+func (e *frameEncoder) finish(drawErr error, outputPath string) error {
+	defer e.stop()
+	close(e.frames)
+	var writeErr = <-e.written
+	if drawErr != nil && writeErr == nil {
+		e.stop()
+	}
+	e.stdin.Close()
+	var waitErr = e.cmd.Wait()
+
+	switch {
+	case writeErr != nil:
+		// ffmpeg stopped reading frames, its output tells why.
+		if waitErr == nil {
+			waitErr = writeErr
+		}
+		return fmt.Errorf("encoding video: %w", commandError(e.ctx, "ffmpeg", removeFailedVideo(outputPath, waitErr), e.output.Bytes()))
+	case drawErr != nil:
+		return fmt.Errorf("drawing frames: %w", removeFailedVideo(outputPath, drawErr))
+	case waitErr != nil:
+		return fmt.Errorf("encoding video: %w", commandError(e.ctx, "ffmpeg", removeFailedVideo(outputPath, waitErr), e.output.Bytes()))
+	}
+	return nil
+}
+
+// streamVideo draws the frames and streams them to ffmpeg, which encodes
+// them with the audio into the video at outputPath.
+func (s *song) streamVideo(ctx context.Context, audioFilePath string, metadataPath string, outputPath string) error {
+	drawCtx, cancelDraw := context.WithCancelCause(ctx)
+	defer cancelDraw(nil)
+
+	encoder, err := s.startEncoder(ctx, cancelDraw, audioFilePath, metadataPath, outputPath)
+	if err != nil {
+		return fmt.Errorf("encoding video: %w", err)
+	}
+	var drawErr = s.createFrames(drawCtx, encoder.put)
+	if drawErr == nil {
+		s.progress.stage(StageEncode)
+	}
+	return encoder.finish(drawErr, outputPath)
+}
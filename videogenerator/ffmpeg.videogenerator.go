@@ -1,38 +1,96 @@
 package videogenerator
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 )
 
-func createVideoFromFrames(framesFolder string, audioFilePath string, outputPath string) error {
+// commandOutputLines is how many of the last lines a failed command wrote
+// are kept in its error.
+const commandOutputLines = 5
 
-	cmdArgs := []string{
-		"-framerate", fmt.Sprintf("%d", fps),
-		"-i", framesFolder + "/fr%05d.png",
-		"-itsoffset", fmt.Sprintf("%fs", startDelaySec),
+// commandError describes why a command failed, with the end of its output.
+func commandError(ctx context.Context, name string, err error, output []byte) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", name, context.Cause(ctx))
+	}
+	var lines = bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+	lines = lines[max(len(lines)-commandOutputLines, 0):]
+	if len(lines) == 1 && len(lines[0]) == 0 {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return fmt.Errorf("%s: %w\n%s", name, err, bytes.Join(lines, []byte("\n")))
+}
+
+// encodingArgs returns the ffmpeg output options of Config.Encoding.
+func (r *Renderer) encodingArgs() []string {
+	var encoding = r.config.Encoding
+	var args = []string{}
+	var addArg = func(name, value string) {
+		if value != "" {
+			args = append(args, name, value)
+		}
+	}
+	addArg("-c:v", encoding.VideoCodec)
+	addArg("-preset", encoding.Preset)
+	addArg("-tune", encoding.Tune)
+	addArg("-pix_fmt", encoding.PixelFormat)
+	if encoding.CRF > 0 {
+		addArg("-crf", fmt.Sprintf("%d", encoding.CRF))
+	}
+	addArg("-c:a", encoding.AudioCodec)
+	addArg("-b:a", encoding.AudioBitrate)
+	return args
+}
+
+// ffmpegArgs returns the ffmpeg command line encoding the video read with
+// videoInput and the audio into outputPath.
+func (s *song) ffmpegArgs(videoInput []string, audioFilePath string, metadataPath string, outputPath string) []string {
+	cmdArgs := []string{"-hide_banner", "-loglevel", "error"}
+	cmdArgs = append(cmdArgs, videoInput...)
+	cmdArgs = append(cmdArgs,
+		"-itsoffset", fmt.Sprintf("%fs", s.config.StartDelaySec),
 		"-i", audioFilePath,
+	)
+	if metadataPath != "" {
+		cmdArgs = append(cmdArgs, "-i", metadataPath, "-map_metadata", "2", "-map_chapters", "2")
+	}
+	cmdArgs = append(cmdArgs,
 		"-map", "0:v", "-map", "1:a",
-		"-preset", "veryfast",
-		"-c:v", "libx264",
-		"-pix_fmt", "yuv420p",
-		"-vcodec", "libx264",
-		"-tune", "animation",
+	)
+	cmdArgs = append(cmdArgs, s.encodingArgs()...)
+	cmdArgs = append(cmdArgs,
 		"-y",
-		"-t", fmt.Sprintf("%f", musicTime),
+		"-t", fmt.Sprintf("%f", s.musicTime),
 		outputPath,
-	}
+	)
+	return cmdArgs
+}
 
-	cmd := exec.Command("ffmpeg", cmdArgs...)
+// removeFailedVideo removes what ffmpeg wrote of a video before failing.
+func removeFailedVideo(outputPath string, err error) error {
+	if removeErr := os.Remove(outputPath); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+		return errors.Join(err, removeErr)
+	}
+	return err
+}
 
-	if err := cmd.Run(); err != nil {
-		var fullCmd string
-		fullCmd += "ffmpeg "
-		for _, v := range cmdArgs {
-			fullCmd += fmt.Sprintf("%s ", v)
-		}
+// createVideoFromFrames encodes the PNG frames saved by saveFramePNG and the
+// audio into the video at outputPath, which is removed if encoding fails.
+func (s *song) createVideoFromFrames(ctx context.Context, audioFilePath string, metadataPath string, outputPath string) error {
+	var videoInput = []string{
+		"-framerate", fmt.Sprintf("%d", s.config.FPS),
+		"-i", filepath.Join(s.framesDir, "fr%05d.png"),
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", s.ffmpegArgs(videoInput, audioFilePath, metadataPath, outputPath)...)
 
-		return fmt.Errorf("error executing FFmpeg command: %s; %v", fullCmd, err)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return commandError(ctx, "ffmpeg", removeFailedVideo(outputPath, err), output)
 	}
 
 	return nil
@@ -1,15 +1,15 @@
 package videogenerator
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"math"
+	"path/filepath"
 	"sync"
-	"sync/atomic"
-	"time"
 
 	"github.com/fogleman/gg"
 	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
 	"golang.org/x/image/font/gofont/goregular"
 )
 
@@ -18,21 +18,40 @@ func getDarkerShade(c Color) Color {
 	return Color{c.R * d, c.G * d, c.B * d}
 }
 
+// getVelocityShade scales a color's brightness by the note velocity, keeping
+// the softest notes readable.
+func (r *Renderer) getVelocityShade(c Color, velocity int) Color {
+	if !r.config.VelocityShading {
+		return c
+	}
+	var d = 0.45 + 0.55*float64(velocity)/127
+	return Color{c.R * d, c.G * d, c.B * d}
+}
+
+func (r *Renderer) getKeyPressDepth(n PlayingNote) float64 {
+	if !r.config.VelocityShading || !n.Active {
+		return 0
+	}
+	return r.keyPressDepth * float64(n.Velocity) / 127
+}
+
 func setRGBColor(dc *gg.Context, c Color) {
 	dc.SetRGB(c.R, c.G, c.B)
 }
 
-func getColor(i int) Color {
+func (r *Renderer) getColor(i int) Color {
+	var colors = r.config.Theme.Colors
 	return colors[i%len(colors)]
 }
 
-func drawKeyboardKey(dc *gg.Context, x, y float64, n PlayingNote) {
-	dc.DrawRectangle(x, y, keyW, keyH)
+func (r *Renderer) drawKeyboardKey(dc *gg.Context, x, y float64, n PlayingNote) {
+	var depth = r.getKeyPressDepth(n)
+	dc.DrawRectangle(x, y+depth, r.keyW, r.keyH-depth)
 
 	if n.Active {
-		setRGBColor(dc, getColor(n.Track))
+		setRGBColor(dc, r.getVelocityShade(r.getColor(n.ColorIndex), n.Velocity))
 	} else {
-		dc.SetRGB(1, 1, 1)
+		setRGBColor(dc, r.config.Theme.WhiteKey)
 	}
 	dc.FillPreserve()
 	dc.SetRGBA(0, 0, 0, 1)
@@ -40,14 +59,14 @@ func drawKeyboardKey(dc *gg.Context, x, y float64, n PlayingNote) {
 	dc.Stroke()
 }
 
-func drawKeyboardBlackKey(dc *gg.Context, x, y float64, n PlayingNote) {
-	x = x + keyW/1.5
-	dc.DrawRectangle(x, y, bKeyW, bKeyH)
+func (r *Renderer) drawKeyboardBlackKey(dc *gg.Context, x, y float64, n PlayingNote) {
+	var depth = r.getKeyPressDepth(n)
+	dc.DrawRectangle(x, y+depth, r.bKeyW, r.bKeyH-depth)
 
 	if n.Active {
-		setRGBColor(dc, getDarkerShade(getColor(n.Track)))
+		setRGBColor(dc, getDarkerShade(r.getVelocityShade(r.getColor(n.ColorIndex), n.Velocity)))
 	} else {
-		dc.SetRGB(0.13, 0.13, 0.13)
+		setRGBColor(dc, r.config.Theme.BlackKey)
 	}
 
 	dc.FillPreserve()
@@ -56,54 +75,52 @@ func drawKeyboardBlackKey(dc *gg.Context, x, y float64, n PlayingNote) {
 	dc.Stroke()
 }
 
-func drawKeyboardOctave(dc *gg.Context, octaveI int, pressedKeys map[int]PlayingNote) {
-
-	var whiteKeysWithBlackKeys = [][]float64{}
-	var octaveX = float64(octaveI)*keyW*7 + 20
-	var keyId = 0
-	for i := 0; i < 7; i++ {
-		if i > 0 {
-			if i != 3 {
-				keyId = keyId + 2
-			} else {
-				keyId++
-			}
+// drawKeyboard draws the white keys first so the black keys lie on top.
+func (r *Renderer) drawKeyboard(dc *gg.Context, pressedKeys map[int]PlayingNote) {
+	for note := r.config.LowestNote; note <= r.config.HighestNote; note++ {
+		if isWhiteNote(note) {
+			r.drawKeyboardKey(dc, r.getNoteXPosition(note), r.keyY, pressedKeys[note])
 		}
-
-		keyNote := octaveI*12 + keyId
-		keyX := octaveX + keyW*float64(i)
-		var isPressed = pressedKeys[keyNote]
-		drawKeyboardKey(dc, keyX, keyY, isPressed)
-
-		if i == 2 || i == 6 {
-			continue
-		}
-		whiteKeysWithBlackKeys = append(whiteKeysWithBlackKeys, []float64{keyX, keyY, float64(keyNote)})
 	}
-
-	for i := 0; i < len(whiteKeysWithBlackKeys); i++ {
-		wk := whiteKeysWithBlackKeys[i]
-		var isPressed = pressedKeys[int(wk[2])+1]
-		drawKeyboardBlackKey(dc, wk[0], wk[1], isPressed)
+	for note := r.config.LowestNote; note <= r.config.HighestNote; note++ {
+		if !isWhiteNote(note) {
+			r.drawKeyboardBlackKey(dc, r.getNoteXPosition(note), r.keyY, pressedKeys[note])
+		}
 	}
 }
 
-func drawKeyboard(dc *gg.Context, pressedKeys map[int]PlayingNote) {
-	for i := 0; i < octavesDisplayed; i++ {
-		drawKeyboardOctave(dc, i, pressedKeys)
+func (r *Renderer) drawSustainTail(dc *gg.Context, n FallingNote) {
+	var x = r.getNoteXPosition(n.Note)
+	var c = r.getVelocityShade(r.getColor(n.ColorIndex), n.Velocity)
+	var noteW = r.keyW
+	if !isWhiteNote(n.Note) {
+		noteW = r.bKeyW
+		c = getDarkerShade(c)
 	}
+	var inset = noteW * 0.2
+	dc.DrawRoundedRectangle(x+inset, n.TailY, noteW-2*inset, n.TailHeight, fallingNoteBorderRadius)
+	dc.SetRGBA(c.R, c.G, c.B, 0.35)
+	dc.Fill()
 }
 
-func drawFallingNotes(dc *gg.Context, fallingNotes []FallingNote) {
+func (r *Renderer) drawFallingNotes(dc *gg.Context, fallingNotes []FallingNote) {
+	for _, n := range fallingNotes {
+		if n.TailHeight > 0 {
+			r.drawSustainTail(dc, n)
+		}
+	}
 	for _, n := range fallingNotes {
+		if n.Height <= 0 {
+			continue
+		}
 		var whiteNote = isWhiteNote(n.Note)
-		var x = getNoteXPosition(n.Note)
+		var x = r.getNoteXPosition(n.Note)
 		if whiteNote {
-			dc.DrawRoundedRectangle(x, n.Y, keyW, n.Height, fallingNoteBorderRadius)
-			setRGBColor(dc, getColor(n.Track))
+			dc.DrawRoundedRectangle(x, n.Y, r.keyW, n.Height, fallingNoteBorderRadius)
+			setRGBColor(dc, r.getVelocityShade(r.getColor(n.ColorIndex), n.Velocity))
 		} else {
-			dc.DrawRoundedRectangle(x, n.Y, bKeyW, n.Height, fallingNoteBorderRadius)
-			setRGBColor(dc, getDarkerShade(getColor(n.Track)))
+			dc.DrawRoundedRectangle(x, n.Y, r.bKeyW, n.Height, fallingNoteBorderRadius)
+			setRGBColor(dc, getDarkerShade(r.getVelocityShade(r.getColor(n.ColorIndex), n.Velocity)))
 		}
 
 		dc.FillPreserve()
@@ -113,92 +130,146 @@ func drawFallingNotes(dc *gg.Context, fallingNotes []FallingNote) {
 	}
 }
 
-func drawScreenAxes(dc *gg.Context) {
-	for i := 0; i < octavesDisplayed; i++ {
-		var x = getNoteXPosition(getNoteByKeyAndOctave(0, i))
-		dc.SetRGBA(1, 1, 1, 0.3)
-		dc.SetLineWidth(0.5)
-		dc.DrawLine(x, 0, x, h)
-		dc.Stroke()
-
-		var x2 = getNoteXPosition(getNoteByKeyAndOctave(5, i))
-		dc.SetRGBA(1, 1, 1, 0.1)
+// drawScreenAxes draws a line up from every C and a fainter one from every F.
+func (r *Renderer) drawScreenAxes(dc *gg.Context) {
+	var c = r.config.Theme.Axis
+	for note := r.config.LowestNote; note <= r.config.HighestNote; note++ {
+		var alpha float64
+		switch note % 12 {
+		case 0:
+			alpha = 0.3
+		case 5:
+			alpha = 0.1
+		default:
+			continue
+		}
+		var x = r.getNoteXPosition(note)
+		dc.SetRGBA(c.R, c.G, c.B, alpha)
 		dc.SetLineWidth(0.5)
-		dc.DrawLine(x2, 0, x2, h)
+		dc.DrawLine(x, 0, x, r.h)
 		dc.Stroke()
 	}
 }
 
-func drawCNotesNotation(dc *gg.Context) {
-	font, err := truetype.Parse(goregular.TTF)
+// regularFont parses the embedded Go font once for every frame.
+var regularFont = sync.OnceValues(func() (*truetype.Font, error) {
+	return truetype.Parse(goregular.TTF)
+})
+
+func getFontFace(size float64) font.Face {
+	ttf, err := regularFont()
 	if err != nil {
-		log.Fatal(err)
+		return basicfont.Face7x13
 	}
 
-	face := truetype.NewFace(font, &truetype.Options{Size: keyW / 2})
+	return truetype.NewFace(ttf, &truetype.Options{Size: size})
+}
 
-	dc.SetFontFace(face)
-	for i := 0; i < octavesDisplayed; i++ {
-		if i == 3 {
+func (r *Renderer) drawCNotesNotation(dc *gg.Context) {
+	// The label fits under the black keys, however wide the keys are.
+	dc.SetFontFace(getFontFace(min(r.keyW, r.keyH-r.bKeyH) / 2))
+	for note := r.config.LowestNote; note <= r.config.HighestNote; note++ {
+		if note%12 != 0 {
+			continue
+		}
+		if note == middleC {
 			dc.SetRGBA(0, 0, 0, 0.8)
 		} else {
 			dc.SetRGBA(0, 0, 0, 0.5)
 		}
-		var x = getNoteXPosition(getNoteByKeyAndOctave(0, i))
-		dc.DrawString(fmt.Sprintf("C%d", i+1), (x + keyW/6), h-10)
+		var x = r.getNoteXPosition(note)
+		dc.DrawString(fmt.Sprintf("C%d", note/12-1), (x + r.keyW/6), r.keyY+r.keyH-10)
 	}
 }
 
-func prepareScreen(dc *gg.Context) {
-	dc.SetRGB(0.17, 0.17, 0.17)
-	dc.DrawRectangle(0, 0, w, h)
+func (r *Renderer) prepareScreen(dc *gg.Context) {
+	setRGBColor(dc, r.config.Theme.Background)
+	dc.DrawRectangle(0, 0, r.w, r.h)
 	dc.Fill()
 }
 
-func createFrame(dc *gg.Context, i int) {
-	var framePressedKeys = frameToPressedKeys[i]
-	var frameFallingNotes = frameFallingNotes[i]
-	prepareScreen(dc)
-	drawScreenAxes(dc)
-	drawKeyboard(dc, framePressedKeys)
-	drawCNotesNotation(dc)
-	drawFallingNotes(dc, frameFallingNotes)
+func (s *song) drawFrame(dc *gg.Context, i int) {
+	var framePressedKeys = s.pressedKeysAt(i)
+	var frameFallingNotes = s.fallingNotesAt(i)
+	var t = float64(i) / float64(s.config.FPS)
+	s.prepareScreen(dc)
+	s.drawScreenAxes(dc)
+	s.drawKeyboard(dc, framePressedKeys)
+	s.drawCNotesNotation(dc)
+	// A frame shows the pedal changes made while it is on screen.
+	s.drawPedalLane(dc, s.pedalsBefore(s.frameTime(i+1)))
+	s.drawFallingNotes(dc, frameFallingNotes)
+	s.drawDrumStrip(dc, t)
+	s.drawLyrics(dc, t)
+	s.drawTitleCard(dc, t)
+}
+
+// frameSink takes the frames drawn by createFrames, in any order, and
+// calls release once done with dc, even when failing.
+type frameSink func(ctx context.Context, dc *gg.Context, i int, release func()) error
+
+// saveFramePNG is the frameSink saving every frame as an image, for
+// createVideoFromFrames.
+func (s *song) saveFramePNG(ctx context.Context, dc *gg.Context, i int, release func()) error {
+	defer release()
 
 	var frStr = fmt.Sprintf("%05d", i+1)
-	dc.SavePNG(fmt.Sprintf("_frames/fr%s.png", frStr))
+	if err := dc.SavePNG(filepath.Join(s.framesDir, fmt.Sprintf("fr%s.png", frStr))); err != nil {
+		return fmt.Errorf("saving frame %d: %w", i+1, err)
+	}
+	return nil
 }
-func createFrames() {
 
-	const maxWorkers = 50
-	sem := make(chan struct{}, maxWorkers)
+// createFrames draws every frame with Config.Workers workers, each with a
+// drawing context of its own, and gives them to sink. It stops at the first
+// failure or once ctx is canceled, after the frames being drawn.
+func (s *song) createFrames(ctx context.Context, sink frameSink) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var maxWorkers = s.config.Workers
 	contexts := make(chan *gg.Context, maxWorkers)
 
 	var wg sync.WaitGroup
 
-	var totalFrames = fps * int(math.Round(musicTime))
-	var finishedFrames atomic.Uint64
-	var startTime = time.Now()
+	var totalFrames = s.totalFrames()
 
 	for i := 0; i < maxWorkers; i++ {
-		dc := gg.NewContext(int(w), int(h))
+		dc := gg.NewContext(int(s.w), int(s.h))
 		contexts <- dc
 	}
 
 	for i := 0; i < totalFrames; i++ {
+		var dc *gg.Context
+		select {
+		case dc = <-contexts:
+		case <-ctx.Done():
+		}
+		if dc == nil {
+			break
+		}
 		wg.Add(1)
-		sem <- struct{}{}
-		dc := <-contexts
 		go func(dc *gg.Context, i int) {
 			defer wg.Done()
-			createFrame(dc, i)
-			f := finishedFrames.Add(1)
-			if int(f)%(fps*30) == 0 {
-				fmt.Printf("Finished frames: %d/%d\tavg time per frame: %.4f\n", f, totalFrames, time.Since(startTime).Seconds()/float64(f))
+			// A frame the drawing code can't handle fails the render,
+			// rather than the program rendering it.
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					cancel(fmt.Errorf("drawing frame %d: %v", i+1, recovered))
+				}
+			}()
+			s.drawFrame(dc, i)
+			if err := sink(ctx, dc, i, func() { contexts <- dc }); err != nil {
+				cancel(err)
+				return
 			}
-			<-sem
-			contexts <- dc
+			s.progress.frameDone()
 		}(dc, i)
 	}
 
 	wg.Wait()
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return nil
 }
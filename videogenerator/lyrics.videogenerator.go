@@ -0,0 +1,126 @@
+package videogenerator
+
+import (
+	"piano-video/midiparser"
+	"sort"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// lyricsPreRollSec shows a line this long before its first syllable is sung.
+const lyricsPreRollSec float64 = 1.5
+
+// getLyricEvents returns the sung syllables of the file: lyric meta events,
+// or for karaoke (.kar) files, whose headers start with "@", the plain
+// text events.
+func getLyricEvents(midiData midiparser.ParsedMidi) []midiparser.TextEvent {
+	if lyrics := midiData.Lyrics(); len(lyrics) > 0 {
+		return lyrics
+	}
+
+	var isKaraoke = false
+	var syllables = []midiparser.TextEvent{}
+	for _, text := range midiData.TextsOfType(midiparser.TextGeneric) {
+		if strings.HasPrefix(text.Text, "@") {
+			isKaraoke = true
+			continue
+		}
+		syllables = append(syllables, text)
+	}
+	if !isKaraoke {
+		return nil
+	}
+	return syllables
+}
+
+// prepareLyrics groups syllables into lines. A line breaks before syllables
+// starting with "/" or "\" (karaoke convention) and after syllables ending
+// with a carriage return or new line (lyric meta event convention).
+func (s *song) prepareLyrics() {
+	var line *LyricLine
+	var endLine = func() {
+		if line != nil && len(line.Syllables) > 0 {
+			s.lyricLines = append(s.lyricLines, *line)
+		}
+		line = nil
+	}
+
+	for _, event := range getLyricEvents(s.midi) {
+		var text = event.Text
+		if strings.HasPrefix(text, "/") || strings.HasPrefix(text, "\\") {
+			endLine()
+			text = text[1:]
+		}
+		var lineBreak = strings.HasSuffix(text, "\r") || strings.HasSuffix(text, "\n")
+		text = strings.TrimRight(text, "\r\n")
+
+		if line == nil {
+			line = &LyricLine{}
+		}
+		if text != "" {
+			line.Syllables = append(line.Syllables, LyricSyllable{
+				Text: text,
+				Time: s.getTickTime(event.OnTick),
+			})
+		}
+		if lineBreak {
+			endLine()
+		}
+	}
+	endLine()
+}
+
+// getLyricLineIndex returns the line shown at time t, or -1 before the first.
+func (s *song) getLyricLineIndex(t float64) int {
+	return sort.Search(len(s.lyricLines), func(i int) bool {
+		return s.lyricLines[i].Syllables[0].Time-lyricsPreRollSec > t
+	}) - 1
+}
+
+func (r *Renderer) drawLyricLine(dc *gg.Context, line LyricLine, t float64, y, fontSize float64, highlight bool) {
+	var text = line.Text()
+	var face = getFontFace(fontSize)
+	dc.SetFontFace(face)
+	var lineW, _ = dc.MeasureString(text)
+	if lineW > r.w*0.9 {
+		fontSize = fontSize * r.w * 0.9 / lineW
+		dc.SetFontFace(getFontFace(fontSize))
+		lineW, _ = dc.MeasureString(text)
+	}
+
+	var x = (r.w - lineW) / 2
+	for _, syllable := range line.Syllables {
+		if highlight && syllable.Time <= t {
+			setRGBColor(dc, r.config.Theme.LyricsHighlightColor)
+		} else if highlight {
+			dc.SetRGB(1, 1, 1)
+		} else {
+			dc.SetRGBA(1, 1, 1, 0.55)
+		}
+		dc.DrawStringAnchored(syllable.Text, x, y, 0, 0.5)
+		var syllableW, _ = dc.MeasureString(syllable.Text)
+		x += syllableW
+	}
+}
+
+func (s *song) drawLyrics(dc *gg.Context, t float64) {
+	if !s.config.ShowLyrics || len(s.lyricLines) == 0 {
+		return
+	}
+	var index = s.getLyricLineIndex(t)
+	if index < 0 {
+		index = 0
+	}
+
+	var bandY = s.drumStripHeight()
+	var bandH = s.h * 0.14
+	dc.SetRGBA(0, 0, 0, 0.55)
+	dc.DrawRectangle(0, bandY, s.w, bandH)
+	dc.Fill()
+
+	s.drawLyricLine(dc, s.lyricLines[index], t, bandY+bandH*0.36, bandH*0.34, true)
+	if index+1 < len(s.lyricLines) {
+		s.drawLyricLine(dc, s.lyricLines[index+1], t, bandY+bandH*0.76, bandH*0.22, false)
+	}
+}
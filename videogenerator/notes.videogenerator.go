@@ -0,0 +1,188 @@
+package videogenerator
+
+import (
+	"math"
+	"sort"
+)
+
+// noteSpan is a drawn note, from the time its key goes down to the time it
+// is released, and on to the end of its sustain tail, in seconds of video.
+type noteSpan struct {
+	note           int
+	colorIndex     int
+	velocity       int
+	onTime         float64
+	offTime        float64
+	sustainEndTime float64
+}
+
+// defaultFallSec is how long notes fall without a lead-in, when the first
+// ones are already on their way down as the video starts.
+const defaultFallSec = 3
+
+// fallSeconds is how long a note takes to fall to its key: the lead-in, so
+// that the first notes fall from the top while the music waits.
+func (s *song) fallSeconds() float64 {
+	if s.config.StartDelaySec <= 0 {
+		return defaultFallSec
+	}
+	return s.config.StartDelaySec
+}
+
+// visibleFrom is when the note starts falling towards its key.
+func (s *song) visibleFrom(n noteSpan) float64 {
+	return n.onTime - s.fallSeconds()
+}
+
+// heldUntil is when the key of the note is released. Notes shorter than a
+// frame are held for one, so that every note shows on its key.
+func (s *song) heldUntil(n noteSpan) float64 {
+	return max(n.offTime, n.onTime+1/float64(s.config.FPS))
+}
+
+// intervalIndex finds which of a set of [start, end) intervals contain a
+// point. The intervals are sorted by start and read as an implicit binary
+// search tree, the middle of each range being the root of its halves, with
+// maxEnd holding the largest end under each root. A query takes
+// O(log n + k) for k intervals found, however long some of them are.
+type intervalIndex struct {
+	starts []float64
+	ends   []float64
+	values []int
+	maxEnd []float64
+}
+
+type interval struct {
+	start, end float64
+	value      int
+}
+
+func newIntervalIndex(intervals []interval) *intervalIndex {
+	sort.SliceStable(intervals, func(i, j int) bool {
+		return intervals[i].start < intervals[j].start
+	})
+	var index = &intervalIndex{
+		starts: make([]float64, len(intervals)),
+		ends:   make([]float64, len(intervals)),
+		values: make([]int, len(intervals)),
+		maxEnd: make([]float64, len(intervals)),
+	}
+	for i, v := range intervals {
+		index.starts[i] = v.start
+		index.ends[i] = v.end
+		index.values[i] = v.value
+	}
+	index.build(0, len(intervals))
+	return index
+}
+
+func (index *intervalIndex) build(lo, hi int) float64 {
+	if lo >= hi {
+		return math.Inf(-1)
+	}
+	var mid = (lo + hi) / 2
+	index.maxEnd[mid] = max(index.ends[mid], index.build(lo, mid), index.build(mid+1, hi))
+	return index.maxEnd[mid]
+}
+
+// find calls found with the value of each interval containing point, in
+// the order of their starts.
+func (index *intervalIndex) find(point float64, found func(value int)) {
+	index.findIn(0, len(index.starts), point, found)
+}
+
+func (index *intervalIndex) findIn(lo, hi int, point float64, found func(value int)) {
+	if lo >= hi {
+		return
+	}
+	var mid = (lo + hi) / 2
+	if index.maxEnd[mid] <= point {
+		return
+	}
+	index.findIn(lo, mid, point, found)
+	if index.starts[mid] > point {
+		return
+	}
+	if point < index.ends[mid] {
+		found(index.values[mid])
+	}
+	index.findIn(mid+1, hi, point, found)
+}
+
+// addNote records a note for indexNotes.
+func (s *song) addNote(n noteSpan) {
+	s.notes = append(s.notes, n)
+}
+
+// indexNotes builds the indexes of the notes falling and of the keys held
+// at each moment, once every note is added.
+func (s *song) indexNotes() {
+	var falling = make([]interval, 0, len(s.notes))
+	var held = make([]interval, 0, len(s.notes))
+	for i, n := range s.notes {
+		var gone = max(s.heldUntil(n), n.sustainEndTime)
+		falling = append(falling, interval{s.visibleFrom(n), gone, i})
+		held = append(held, interval{n.onTime, s.heldUntil(n), i})
+	}
+	s.fallingNotes = newIntervalIndex(falling)
+	s.heldNotes = newIntervalIndex(held)
+}
+
+// frameTime returns the time of frame i in the video.
+func (s *song) frameTime(i int) float64 {
+	return float64(i) / float64(s.config.FPS)
+}
+
+// pressedKeysAt returns the keys held down at frame i. When notes overlap
+// on a key, the last one struck shows.
+func (s *song) pressedKeysAt(i int) map[int]PlayingNote {
+	var pressedKeys = map[int]PlayingNote{}
+	s.heldNotes.find(s.frameTime(i), func(value int) {
+		var n = s.notes[value]
+		pressedKeys[n.note] = PlayingNote{Active: true, ColorIndex: n.colorIndex, Velocity: n.velocity}
+	})
+	return pressedKeys
+}
+
+// fallingNotesAt returns the notes on screen at frame i, placed on their
+// way down to the keyboard from the exact time of the frame.
+func (s *song) fallingNotesAt(i int) []FallingNote {
+	var t = s.frameTime(i)
+	var fallingNotes = []FallingNote{}
+	s.fallingNotes.find(t, func(value int) {
+		fallingNotes = append(fallingNotes, s.getFallingNote(s.notes[value], t))
+	})
+	return fallingNotes
+}
+
+// getFallingNote places a note at time t. Notes fall the height above the
+// keyboard in fallSeconds, reaching their key when struck.
+func (s *song) getFallingNote(n noteSpan, t float64) FallingNote {
+	var maxRange = s.keyY
+	var rangePerSecond = maxRange / s.fallSeconds()
+
+	var minDisplayedHeight = s.h * 0.0208
+	var noteFullHeight = max((n.offTime-n.onTime)*rangePerSecond, minDisplayedHeight)
+	var noteY = maxRange - (n.onTime-t)*rangePerSecond - noteFullHeight
+	var noteDisplayedHeight float64
+	if noteY+noteFullHeight > maxRange {
+		noteDisplayedHeight = max(maxRange-noteY, 0)
+	} else {
+		noteDisplayedHeight = noteFullHeight
+	}
+
+	var tailFullHeight = max(n.sustainEndTime-n.offTime, 0) * rangePerSecond
+	var tailY = noteY - tailFullHeight
+	var tailDisplayedHeight = max(min(noteY, maxRange)-tailY, 0)
+
+	return FallingNote{
+		Note:       n.note,
+		Y:          noteY,
+		Height:     noteDisplayedHeight,
+		ColorIndex: n.colorIndex,
+		Velocity:   n.velocity,
+
+		TailY:      tailY,
+		TailHeight: tailDisplayedHeight,
+	}
+}
@@ -0,0 +1,82 @@
+package videogenerator
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIntervalIndex(t *testing.T) {
+	var random = rand.New(rand.NewSource(1))
+	var many = []interval{}
+	for i := 0; i < 500; i++ {
+		var start = random.Float64() * 100
+		// A few long intervals, which contain points far from their start.
+		var length = random.Float64() * 2
+		if i%50 == 0 {
+			length = random.Float64() * 80
+		}
+		many = append(many, interval{start, start + length, i})
+	}
+
+	var tests = []struct {
+		name      string
+		intervals []interval
+		points    []float64
+	}{
+		{
+			name:   "empty",
+			points: []float64{0, 1},
+		},
+		{
+			name:      "bounds",
+			intervals: []interval{{1, 2, 0}, {2, 3, 1}},
+			points:    []float64{0.5, 1, 1.5, 2, 3},
+		},
+		{
+			name:      "empty interval",
+			intervals: []interval{{1, 1, 0}, {0, 2, 1}},
+			points:    []float64{1},
+		},
+		{
+			name:      "same start",
+			intervals: []interval{{1, 5, 0}, {1, 2, 1}, {1, 3, 2}},
+			points:    []float64{1, 2.5, 4},
+		},
+		{
+			name:      "long interval",
+			intervals: []interval{{0, 100, 0}, {1, 2, 1}, {3, 4, 2}, {5, 6, 3}, {7, 8, 4}},
+			points:    []float64{0.5, 3.5, 50, 100},
+		},
+		{
+			name:      "many",
+			intervals: many,
+			points:    []float64{-1, 0, 10, 25.5, 50, 73.2, 99.9, 150},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var index = newIntervalIndex(append([]interval{}, test.intervals...))
+			var sorted = append([]interval{}, test.intervals...)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return sorted[i].start < sorted[j].start
+			})
+			for _, point := range test.points {
+				var got = []int{}
+				index.find(point, func(value int) {
+					got = append(got, value)
+				})
+				var want = []int{}
+				for _, v := range sorted {
+					if v.start <= point && point < v.end {
+						want = append(want, v.value)
+					}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("find(%g) = %v, want %v", point, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package videogenerator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var resolutionNames = map[string]ScreenResolution{
+	"1080p": resolution1080p,
+	"720p":  resolution720p,
+	"480p":  resolution480p,
+	"360p":  resolution360p,
+}
+
+// keyboardNames are the usual piano and keyboard sizes by their number of
+// keys.
+var keyboardNames = map[string][2]int{
+	"88keys": {21, 108},
+	"76keys": {28, 103},
+	"61keys": {36, 96},
+	"49keys": {36, 84},
+	"25keys": {48, 72},
+}
+
+var colorModeNames = map[string]ColorMode{
+	"track":      ColorByTrack,
+	"channel":    ColorByChannel,
+	"instrument": ColorByInstrument,
+}
+
+// ParseResolution reads a resolution name such as "720p" or a size such as
+// "1280x720".
+func ParseResolution(value string) (ScreenResolution, error) {
+	if resolution, exists := resolutionNames[strings.ToLower(value)]; exists {
+		return resolution, nil
+	}
+
+	width, height, found := strings.Cut(strings.ToLower(value), "x")
+	if found {
+		w, errW := strconv.Atoi(width)
+		h, errH := strconv.Atoi(height)
+		if errW == nil && errH == nil && w > 0 && h > 0 {
+			return ScreenResolution{float64(w), float64(h)}, nil
+		}
+	}
+	return ScreenResolution{}, fmt.Errorf("invalid resolution %q, want 1080p, 720p, 480p, 360p or WIDTHxHEIGHT", value)
+}
+
+// ParseKeyboard reads the keys to draw, either a keyboard size such as
+// "88keys" or a number of octaves centered on middle C, and returns the
+// lowest and highest MIDI notes.
+func ParseKeyboard(value string) (lowestNote int, highestNote int, err error) {
+	if keys, exists := keyboardNames[strings.ToLower(value)]; exists {
+		return keys[0], keys[1], nil
+	}
+
+	octaves, err := strconv.Atoi(value)
+	if err != nil || octaves < 1 || octaves > 10 {
+		return 0, 0, fmt.Errorf("invalid keyboard %q, want 1 to 10 octaves or 25keys, 49keys, 61keys, 76keys, 88keys", value)
+	}
+	lowestNote = 12 * (5 - octaves/2)
+	return lowestNote, lowestNote + octaves*12 - 1, nil
+}
+
+// ParseColorMode reads "track", "channel" or "instrument".
+func ParseColorMode(value string) (ColorMode, error) {
+	if mode, exists := colorModeNames[strings.ToLower(value)]; exists {
+		return mode, nil
+	}
+	return ColorByTrack, fmt.Errorf("invalid note coloring %q, want track, channel or instrument", value)
+}
+
+// ParseColor reads a color written as "#rrggbb" or "#rgb".
+func ParseColor(value string) (Color, error) {
+	var hex = strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 || !strings.HasPrefix(value, "#") {
+		return Color{}, fmt.Errorf("invalid color %q, want #rrggbb", value)
+	}
+	return Color{
+		R: float64(rgb>>16&0xFF) / 255,
+		G: float64(rgb>>8&0xFF) / 255,
+		B: float64(rgb&0xFF) / 255,
+	}, nil
+}
+
+// ParseSynth returns the audio renderer named "timidity", "fluidsynth" or
+// "builtin". The last two play the sound font at soundFontPath, which
+// timidity ignores for its own configuration.
+func ParseSynth(name string, soundFontPath string) (AudioRenderer, error) {
+	switch strings.ToLower(name) {
+	case "timidity":
+		return Timidity{}, nil
+	case "fluidsynth":
+		if soundFontPath == "" {
+			return nil, fmt.Errorf("the fluidsynth synth needs a sound font")
+		}
+		return FluidSynth{SoundFontPath: soundFontPath}, nil
+	case "builtin":
+		if soundFontPath == "" {
+			return nil, fmt.Errorf("the builtin synth needs a sound font")
+		}
+		return SoundFontSynth{SoundFontPath: soundFontPath}, nil
+	}
+	return nil, fmt.Errorf("invalid synth %q, want timidity, fluidsynth or builtin", name)
+}
@@ -0,0 +1,131 @@
+package videogenerator
+
+import (
+	"piano-video/midiparser"
+	"sort"
+
+	"github.com/fogleman/gg"
+)
+
+var pedalControllers = []byte{midiparser.ControllerSoft, midiparser.ControllerSostenuto, midiparser.ControllerSustain}
+var pedalNames = map[byte]string{
+	midiparser.ControllerSoft:      "Soft",
+	midiparser.ControllerSostenuto: "Sostenuto",
+	midiparser.ControllerSustain:   "Sustain",
+}
+
+func (r *Renderer) pedalLaneHeight() float64 {
+	if !r.config.ShowPedalLane {
+		return 0
+	}
+	return r.pedalLaneH
+}
+
+// pedalTimeline holds the positions a pedal of one channel moves to, and
+// the times it does, in seconds of video.
+type pedalTimeline struct {
+	controller byte
+	times      []float64
+	values     []byte
+}
+
+// preparePedals gathers the pedal timelines of the channels whose notes are
+// drawn.
+func (s *song) preparePedals(drawnChannels map[byte]bool) {
+	for channel := range drawnChannels {
+		for _, controller := range pedalControllers {
+			var changes = s.midi.Controller(channel, controller)
+			if len(changes) == 0 {
+				continue
+			}
+			var timeline = pedalTimeline{
+				controller: controller,
+				times:      make([]float64, len(changes)),
+				values:     make([]byte, len(changes)),
+			}
+			for i, change := range changes {
+				timeline.times[i] = s.getTickTime(change.OnTick)
+				timeline.values[i] = change.Value
+			}
+			s.pedalTimelines = append(s.pedalTimelines, timeline)
+		}
+	}
+}
+
+// pedalsBefore returns the deepest position of each pedal across the drawn
+// channels once the changes made before time t are applied.
+func (s *song) pedalsBefore(t float64) Pedals {
+	var pedals = Pedals{}
+	for _, timeline := range s.pedalTimelines {
+		i := sort.Search(len(timeline.times), func(i int) bool {
+			return timeline.times[i] >= t
+		})
+		if i > 0 && timeline.values[i-1] > pedals[timeline.controller] {
+			pedals[timeline.controller] = timeline.values[i-1]
+		}
+	}
+	return pedals
+}
+
+// getSustainSpans returns the sustain pedal spans per channel for the note
+// tails.
+func getSustainSpans(midiData midiparser.ParsedMidi) map[byte][]midiparser.PedalSpan {
+	var sustainSpans = map[byte][]midiparser.PedalSpan{}
+	for channel := range midiData.ControlChanges {
+		sustainSpans[channel] = midiData.PedalSpans(channel, midiparser.ControllerSustain)
+	}
+	return sustainSpans
+}
+
+// getSustainEndTick returns the tick the damper releases a note ending at
+// offTick, or offTick itself when the sustain pedal isn't held.
+func getSustainEndTick(spans []midiparser.PedalSpan, offTick int) int {
+	i := sort.Search(len(spans), func(i int) bool {
+		return spans[i].OffTick > offTick
+	})
+	if i < len(spans) && spans[i].OnTick <= offTick {
+		return spans[i].OffTick
+	}
+	return offTick
+}
+
+func (r *Renderer) drawPedalLane(dc *gg.Context, pedals Pedals) {
+	if !r.config.ShowPedalLane {
+		return
+	}
+	var laneX float64 = 20
+	var laneY = r.keyY + r.keyH
+	var laneW = float64(r.whiteKeysDisplayed) * r.keyW
+	var padding = r.pedalLaneH * 0.15
+	var segmentW = laneW / float64(len(pedalControllers))
+
+	setRGBColor(dc, r.config.Theme.Panel)
+	dc.DrawRectangle(laneX, laneY, laneW, r.pedalLaneH)
+	dc.Fill()
+
+	dc.SetFontFace(getFontFace(r.pedalLaneH * 0.4))
+	for i, controller := range pedalControllers {
+		var value = pedals[controller]
+		var x = laneX + float64(i)*segmentW + padding
+		var barW = segmentW - 2*padding
+		var barH = r.pedalLaneH - 2*padding
+
+		setRGBColor(dc, r.config.Theme.Pad)
+		dc.DrawRoundedRectangle(x, laneY+padding, barW, barH, barH/4)
+		dc.Fill()
+
+		if value > 0 {
+			var depth = float64(value) / 127
+			var c = r.config.Theme.PedalColor
+			if !midiparser.IsPedalDown(value) {
+				c = getDarkerShade(getDarkerShade(c))
+			}
+			setRGBColor(dc, c)
+			dc.DrawRoundedRectangle(x, laneY+padding, barW*depth, barH, barH/4)
+			dc.Fill()
+		}
+
+		dc.SetRGBA(1, 1, 1, 0.8)
+		dc.DrawStringAnchored(pedalNames[controller], x+barW/2, laneY+r.pedalLaneH/2, 0.5, 0.35)
+	}
+}
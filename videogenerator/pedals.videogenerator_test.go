@@ -0,0 +1,30 @@
+package videogenerator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPedalsBefore(t *testing.T) {
+	var s = &song{pedalTimelines: []pedalTimeline{
+		{controller: 64, times: []float64{1, 2, 3}, values: []byte{127, 0, 64}},
+		{controller: 64, times: []float64{1.5, 2.5}, values: []byte{100, 0}},
+		{controller: 67, times: []float64{2}, values: []byte{127}},
+	}}
+	var tests = []struct {
+		t    float64
+		want Pedals
+	}{
+		{0, Pedals{}},
+		{1, Pedals{}},
+		{1.1, Pedals{64: 127}},
+		{2.1, Pedals{64: 100, 67: 127}},
+		{2.6, Pedals{67: 127}},
+		{10, Pedals{64: 64, 67: 127}},
+	}
+	for _, test := range tests {
+		if got := s.pedalsBefore(test.t); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pedalsBefore(%g) = %v, want %v", test.t, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package videogenerator
+
+import (
+	"sync"
+	"time"
+)
+
+// Stage is a step of a render.
+type Stage string
+
+const (
+	StageParse  Stage = "parse"
+	StageAudio  Stage = "audio"
+	StageFrames Stage = "frames"
+	StageEncode Stage = "encode"
+)
+
+// Progress tells how far a render got.
+type Progress struct {
+	Stage       Stage
+	FramesDone  int
+	FramesTotal int
+	// Elapsed is the time since the render started. ETA estimates the time
+	// left to draw the frames from the pace so far, zero until known.
+	Elapsed time.Duration
+	ETA     time.Duration
+}
+
+// progressInterval is the least time between two reports of frames drawn.
+const progressInterval = 250 * time.Millisecond
+
+// progressReporter passes the progress of a render to Config.Progress.
+type progressReporter struct {
+	report func(Progress)
+
+	mu          sync.Mutex
+	startTime   time.Time
+	framesStart time.Time
+	lastReport  time.Time
+	progress    Progress
+}
+
+func newProgressReporter(report func(Progress)) *progressReporter {
+	return &progressReporter{report: report, startTime: time.Now()}
+}
+
+func (p *progressReporter) stage(stage Stage) {
+	if p.report == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Stage = stage
+	p.progress.ETA = 0
+	if stage == StageFrames {
+		p.framesStart = time.Now()
+	}
+	p.send(time.Now())
+}
+
+func (p *progressReporter) framesTotal(total int) {
+	if p.report == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.FramesTotal = total
+}
+
+// frameDone counts a drawn frame, reporting it unless the last report is
+// too recent.
+func (p *progressReporter) frameDone() {
+	if p.report == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.FramesDone++
+
+	var now = time.Now()
+	if now.Sub(p.lastReport) < progressInterval && p.progress.FramesDone < p.progress.FramesTotal {
+		return
+	}
+	var perFrame = now.Sub(p.framesStart) / time.Duration(p.progress.FramesDone)
+	p.progress.ETA = perFrame * time.Duration(p.progress.FramesTotal-p.progress.FramesDone)
+	p.send(now)
+}
+
+func (p *progressReporter) send(now time.Time) {
+	p.progress.Elapsed = now.Sub(p.startTime)
+	p.lastReport = now
+	p.report(p.progress)
+}
@@ -0,0 +1,218 @@
+package videogenerator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"piano-video/midiparser"
+	"slices"
+
+	"github.com/fogleman/gg"
+)
+
+// maxKeyboardShare is the largest part of the frame height the keys take.
+const maxKeyboardShare = 0.25
+
+// Renderer turns MIDI files into videos with the settings of its Config. A
+// Renderer is never modified after NewRenderer, so one may run any number
+// of renders at a time, as may Renderers with different settings.
+type Renderer struct {
+	config Config
+
+	w, h               float64
+	lowestWhiteKey     int
+	whiteKeysDisplayed int
+	keyW, keyH         float64
+	bKeyW, bKeyH       float64
+	keyPressDepth      float64
+	pedalLaneH         float64
+	drumStripH         float64
+	keyY               float64
+}
+
+func NewRenderer(config Config) *Renderer {
+	config.Theme = config.Theme.clone()
+	if len(config.Theme.Colors) == 0 {
+		config.Theme.Colors = themeDark.clone().Colors
+	}
+	config.DrumChannels = slices.Clone(config.DrumChannels)
+	config.Workers = max(config.Workers, 1)
+
+	var r = &Renderer{config: config}
+	r.w = config.Resolution[0]
+	r.h = config.Resolution[1]
+	r.lowestWhiteKey = countWhiteNotes(config.LowestNote)
+	r.whiteKeysDisplayed = countWhiteNotes(config.HighestNote+1) - r.lowestWhiteKey
+	r.keyW = (r.w - 40) / float64(r.whiteKeysDisplayed)
+	// Keyboards of few keys would fill the frame with their wide keys.
+	r.keyH = min(r.keyW*6, r.h*maxKeyboardShare)
+	r.bKeyW = r.keyW / 1.7
+	r.bKeyH = r.keyH / 1.6
+	r.keyPressDepth = r.keyH * 0.04
+	r.pedalLaneH = r.keyH / 5
+	r.drumStripH = r.h * 0.08
+	r.keyY = r.h - r.keyH - r.pedalLaneHeight()
+	return r
+}
+
+func (r *Renderer) Config() Config {
+	return r.config
+}
+
+// song holds the state of a single render.
+type song struct {
+	*Renderer
+
+	midi      midiparser.ParsedMidi
+	framesDir string
+	progress  *progressReporter
+
+	notes          []noteSpan
+	fallingNotes   *intervalIndex
+	heldNotes      *intervalIndex
+	tempoMap       *midiparser.TempoMap
+	lyricLines     []LyricLine
+	drumHits       map[int][]DrumHit
+	drumPads       []int
+	pedalTimelines []pedalTimeline
+	musicTime      float64
+}
+
+func (r *Renderer) newSong(midiData midiparser.ParsedMidi, framesDir string) *song {
+	return &song{
+		Renderer:  r,
+		midi:      midiData,
+		framesDir: framesDir,
+		progress:  newProgressReporter(nil),
+
+		notes:          []noteSpan{},
+		tempoMap:       midiData.Meta.TempoMap(),
+		lyricLines:     []LyricLine{},
+		drumHits:       map[int][]DrumHit{},
+		drumPads:       []int{},
+		pedalTimelines: []pedalTimeline{},
+	}
+}
+
+func parseMidiFile(midiFilePath string) (midiparser.ParsedMidi, error) {
+	f, err := os.Open(midiFilePath)
+	if err != nil {
+		return midiparser.ParsedMidi{}, err
+	}
+	defer f.Close()
+
+	parsedMidi, err := midiparser.ParseFile(f)
+	if err != nil {
+		return midiparser.ParsedMidi{}, fmt.Errorf("reading %s: %w", midiFilePath, err)
+	}
+	return parsedMidi, nil
+}
+
+// Render makes a video of the MIDI file at midiFilePath and writes it to
+// outputVideoPath. The frames are streamed to ffmpeg as they are drawn,
+// while audio and metadata are kept in a folder of their own under
+// Config.FramesFolderPath, which is removed once done, whether the render
+// succeeds, fails or is stopped by canceling ctx. With
+// Config.DebugPNGFrames the folder also holds the frames, and is kept.
+func (r *Renderer) Render(ctx context.Context, midiFilePath string, outputVideoPath string) error {
+	var progress = newProgressReporter(r.config.Progress)
+	progress.stage(StageParse)
+	parsedMidi, err := parseMidiFile(midiFilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(r.config.FramesFolderPath, 0755); err != nil {
+		return fmt.Errorf("creating frames folder: %w", err)
+	}
+	framesDir, err := os.MkdirTemp(r.config.FramesFolderPath, "render-")
+	if err != nil {
+		return fmt.Errorf("creating frames folder: %w", err)
+	}
+	if !r.config.DebugPNGFrames {
+		defer os.RemoveAll(framesDir)
+	}
+
+	var s = r.newSong(parsedMidi, framesDir)
+	s.progress = progress
+
+	progress.stage(StageAudio)
+	var audioMidiPath = midiFilePath
+	if r.config.AudioFilePath == "" && !r.config.Selection.Audio.IsEmpty() {
+		audioMidiPath = filepath.Join(framesDir, "audio.mid")
+		if err := s.writeAudioMidi(midiFilePath, r.config.Selection.Audio, audioMidiPath); err != nil {
+			return fmt.Errorf("writing audio tracks: %w", err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var audioFilePath = r.config.AudioFilePath
+	if audioFilePath == "" {
+		audioFilePath = filepath.Join(framesDir, "audio.wav")
+		var audioRenderer = r.config.AudioRenderer
+		if audioRenderer == nil {
+			audioRenderer = Timidity{}
+		}
+		if err := audioRenderer.RenderAudio(ctx, audioMidiPath, audioFilePath); err != nil {
+			return fmt.Errorf("synthesizing audio: %w", err)
+		}
+	}
+
+	s.prepareMidi()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var chapters = s.getChapters()
+	var metadataPath string
+	if r.config.WriteChapters && (len(chapters) > 0 || parsedMidi.Title() != "") {
+		metadataPath = filepath.Join(framesDir, "metadata.txt")
+		if err := writeFFMetadata(metadataPath, parsedMidi.Title(), chapters); err != nil {
+			return fmt.Errorf("writing chapters: %w", err)
+		}
+	}
+
+	progress.framesTotal(s.totalFrames())
+	progress.stage(StageFrames)
+	if r.config.DebugPNGFrames {
+		if err := s.createFrames(ctx, s.saveFramePNG); err != nil {
+			return fmt.Errorf("drawing frames: %w", err)
+		}
+		progress.stage(StageEncode)
+		if err := s.createVideoFromFrames(ctx, audioFilePath, metadataPath, outputVideoPath); err != nil {
+			return fmt.Errorf("encoding video: %w", err)
+		}
+	} else if err := s.streamVideo(ctx, audioFilePath, metadataPath, outputVideoPath); err != nil {
+		return err
+	}
+
+	if r.config.WriteSubtitles && len(chapters) > 0 {
+		if err := writeChapterSidecars(outputVideoPath, chapters); err != nil {
+			return fmt.Errorf("writing chapter subtitles: %w", err)
+		}
+	}
+	return nil
+}
+
+// Preview draws the frame shown seconds into the video of the MIDI file at
+// midiFilePath and saves it as a PNG image, without rendering the video.
+func (r *Renderer) Preview(midiFilePath string, seconds float64, outputImagePath string) error {
+	parsedMidi, err := parseMidiFile(midiFilePath)
+	if err != nil {
+		return err
+	}
+
+	var s = r.newSong(parsedMidi, "")
+	s.prepareMidi()
+
+	var frame = int(seconds * float64(r.config.FPS))
+	if seconds < 0 || frame >= s.totalFrames() {
+		return fmt.Errorf("preview at %.2fs is outside the video, which is %.2fs long", seconds, s.musicTime)
+	}
+
+	var dc = gg.NewContext(int(r.w), int(r.h))
+	s.drawFrame(dc, frame)
+	return dc.SavePNG(outputImagePath)
+}
@@ -0,0 +1,32 @@
+package videogenerator
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeyboardLayout(t *testing.T) {
+	for _, resolution := range []string{"1080p", "720p", "360p", "1920x400", "720x1280"} {
+		for _, keyboard := range []string{"1", "2", "5", "10", "25keys", "88keys"} {
+			t.Run(fmt.Sprintf("%s %s", resolution, keyboard), func(t *testing.T) {
+				var config = DefaultConfig()
+				var err error
+				if config.Resolution, err = ParseResolution(resolution); err != nil {
+					t.Fatal(err)
+				}
+				if config.LowestNote, config.HighestNote, err = ParseKeyboard(keyboard); err != nil {
+					t.Fatal(err)
+				}
+				var r = NewRenderer(config)
+				// The falling notes get at least half of the frame, what the
+				// pedal lane and drum strip leave included.
+				if r.keyY-r.drumStripH < r.h/2 {
+					t.Errorf("keys start at %.0f of %.0f, want room for the falling notes", r.keyY, r.h)
+				}
+				if r.bKeyH >= r.keyH || r.keyH <= 0 {
+					t.Errorf("key heights %.0f and %.0f", r.keyH, r.bKeyH)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package videogenerator
+
+import (
+	"bytes"
+	"os"
+	"piano-video/midiparser"
+	"slices"
+	"strings"
+)
+
+// Selection picks the notes of a song by track, track name, channel, General
+// MIDI patch or instrument family. Empty include lists match everything and
+// excludes win over includes. Track names and families match regardless of
+// case; notes on percussion channels belong to the "Drums" family.
+type Selection struct {
+	IncludeTracks     []int    `json:"includeTracks,omitempty"`
+	ExcludeTracks     []int    `json:"excludeTracks,omitempty"`
+	IncludeTrackNames []string `json:"includeTrackNames,omitempty"`
+	ExcludeTrackNames []string `json:"excludeTrackNames,omitempty"`
+	IncludeChannels   []byte   `json:"includeChannels,omitempty"`
+	ExcludeChannels   []byte   `json:"excludeChannels,omitempty"`
+	IncludePatches    []byte   `json:"includePatches,omitempty"`
+	ExcludePatches    []byte   `json:"excludePatches,omitempty"`
+	IncludeFamilies   []string `json:"includeFamilies,omitempty"`
+	ExcludeFamilies   []string `json:"excludeFamilies,omitempty"`
+}
+
+// TrackSelection separates what is drawn from what is heard, e.g. to show
+// only the piano of an orchestral arrangement while playing all of it.
+type TrackSelection struct {
+	Draw  Selection `json:"draw"`
+	Audio Selection `json:"audio"`
+}
+
+// DefaultDrawSelection leaves out synth effect, percussive and sound effect
+// patches, which don't map to piano keys.
+func DefaultDrawSelection() Selection {
+	var selection = Selection{}
+	for patch := byte(81); patch < 128; patch++ {
+		selection.ExcludePatches = append(selection.ExcludePatches, patch)
+	}
+	return selection
+}
+
+func DefaultTrackSelection() TrackSelection {
+	return TrackSelection{Draw: DefaultDrawSelection()}
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
+
+// IsEmpty reports whether the selection matches every note.
+func (s Selection) IsEmpty() bool {
+	return len(s.IncludeTracks) == 0 && len(s.ExcludeTracks) == 0 &&
+		len(s.IncludeTrackNames) == 0 && len(s.ExcludeTrackNames) == 0 &&
+		len(s.IncludeChannels) == 0 && len(s.ExcludeChannels) == 0 &&
+		len(s.IncludePatches) == 0 && len(s.ExcludePatches) == 0 &&
+		len(s.IncludeFamilies) == 0 && len(s.ExcludeFamilies) == 0
+}
+
+func (s Selection) Matches(trackIndex int, trackName string, channel byte, patch byte) bool {
+	return s.matches(trackIndex, trackName, channel, patch, midiparser.IsPercussionChannel(channel))
+}
+
+func (s Selection) matches(trackIndex int, trackName string, channel byte, patch byte, isDrum bool) bool {
+	var family = midiparser.InstrumentFamily(patch)
+	if isDrum {
+		family = midiparser.PercussionFamily
+	}
+
+	if slices.Contains(s.ExcludeTracks, trackIndex) ||
+		containsFold(s.ExcludeTrackNames, trackName) ||
+		slices.Contains(s.ExcludeChannels, channel) ||
+		slices.Contains(s.ExcludePatches, patch) ||
+		containsFold(s.ExcludeFamilies, family) {
+		return false
+	}
+
+	return (len(s.IncludeTracks) == 0 || slices.Contains(s.IncludeTracks, trackIndex)) &&
+		(len(s.IncludeTrackNames) == 0 || containsFold(s.IncludeTrackNames, trackName)) &&
+		(len(s.IncludeChannels) == 0 || slices.Contains(s.IncludeChannels, channel)) &&
+		(len(s.IncludePatches) == 0 || slices.Contains(s.IncludePatches, patch)) &&
+		(len(s.IncludeFamilies) == 0 || containsFold(s.IncludeFamilies, family))
+}
+
+// matchesEvent checks a note of the song against the selection, using the
+// program its channel plays at tick and counting the configured drum
+// channels as percussion.
+func (s *song) matchesEvent(selection Selection, trackIndex int, channel byte, tick int) bool {
+	var trackName string
+	if trackIndex < len(s.midi.Tracks) {
+		trackName = s.midi.Tracks[trackIndex].Name
+	}
+	return selection.matches(trackIndex, trackName, channel, s.midi.ProgramAt(channel, tick).Patch, s.isDrumChannel(channel))
+}
+
+// writeAudioMidi writes the part of the song selected for the audio track to
+// outputPath, with the setup of the channels whose notes it keeps.
+func (s *song) writeAudioMidi(midiFilePath string, selection Selection, outputPath string) error {
+	data, err := os.ReadFile(midiFilePath)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	err = midiparser.Filter(bytes.NewReader(data), &out, func(track int, channel byte, tick int) bool {
+		return s.matchesEvent(selection, track, channel, tick)
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, out.Bytes(), 0644)
+}
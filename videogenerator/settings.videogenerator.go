@@ -1,22 +1,114 @@
 package videogenerator
 
-var colors = []Color{colorOrange, colorGreen, colorBlue, colorGrey, colorGrey}
+// Config holds every setting of a render. DefaultConfig returns the settings
+// videos are normally made with; adjust a copy of it rather than building
+// one from scratch.
+type Config struct {
+	Resolution    ScreenResolution
+	FPS           int
+	StartDelaySec float64
+	Workers       int
 
-var defaultResolution = resolution1080p
+	// LowestNote and HighestNote are the MIDI notes of the first and last
+	// keys drawn, see ParseKeyboard.
+	LowestNote  int
+	HighestNote int
 
-var w float64 = defaultResolution[0]
-var h float64 = defaultResolution[1]
-var octavesDisplayed = 7
+	Theme        Theme
+	ColorNotesBy ColorMode
 
-var whiteKeysDisplayed = 7 * octavesDisplayed
-var keyW float64 = (w - 40) / float64(whiteKeysDisplayed)
-var keyH float64 = keyW * 6
-var bKeyW float64 = keyW / 1.7
-var bKeyH float64 = keyH / 1.6
+	// VelocityShading dims soft notes and presses keys deeper for loud ones.
+	VelocityShading bool
+
+	// ShowPedalLane draws the soft, sostenuto and sustain pedals under the
+	// keyboard, ShowSustainTails fades notes held by the damper pedal.
+	ShowPedalLane    bool
+	ShowSustainTails bool
+
+	// ShowLyrics overlays lyric and karaoke text above the falling notes.
+	ShowLyrics bool
+
+	// WriteChapters embeds MIDI markers as MP4 chapters, WriteSubtitles also
+	// writes them as .vtt and .srt files next to the video.
+	WriteChapters  bool
+	WriteSubtitles bool
+
+	// Percussion channels are left off the keyboard unless DrumsOnKeyboard
+	// is set. DrumChannels adds channels to General MIDI channel 10,
+	// ShowDrumStrip draws their hits as pads.
+	DrumChannels    []byte
+	ShowDrumStrip   bool
+	DrumsOnKeyboard bool
+
+	Selection TrackSelection
+
+	// AudioFilePath plays a recording instead of synthesizing the MIDI file.
+	// It should start where the MIDI file does.
+	AudioFilePath string
+	// AudioRenderer synthesizes the MIDI file when there is no recording.
+	// Timidity is used if it is nil.
+	AudioRenderer AudioRenderer
+
+	TitleCard TitleCard
+	Encoding  Encoding
+
+	// FramesFolderPath holds a temporary folder for each render, with its
+	// audio and metadata.
+	FramesFolderPath string
+	// DebugPNGFrames saves every frame as a PNG image in the render's folder,
+	// which is then kept, and encodes the video from the images once all are
+	// drawn, rather than streaming the frames to ffmpeg. It is much slower
+	// and takes gigabytes of disk, but shows the frames ffmpeg was given.
+	DebugPNGFrames bool
+
+	// Progress, when set, is called as a render moves through its stages
+	// and draws frames. Calls never overlap, and should return quickly.
+	Progress func(Progress)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Resolution:    resolution1080p,
+		FPS:           60,
+		StartDelaySec: 3,
+		Workers:       50,
+
+		LowestNote:  24,
+		HighestNote: 107,
+
+		Theme:        themeDark.clone(),
+		ColorNotesBy: ColorByTrack,
+
+		VelocityShading: true,
+
+		ShowPedalLane:    true,
+		ShowSustainTails: true,
+
+		ShowLyrics: true,
+
+		WriteChapters:  true,
+		WriteSubtitles: false,
+
+		DrumChannels:    []byte{},
+		ShowDrumStrip:   false,
+		DrumsOnKeyboard: false,
+
+		Selection: DefaultTrackSelection(),
+
+		AudioRenderer: Timidity{},
+
+		Encoding: Encoding{
+			VideoCodec:  "libx264",
+			Preset:      "veryfast",
+			Tune:        "animation",
+			PixelFormat: "yuv420p",
+		},
+
+		FramesFolderPath: framesFolderPath,
+	}
+}
 
-const DEBUG = false
-const fps = 60
-const startDelaySec float64 = 3
 const fallingNoteBorderRadius float64 = 6
+const middleC = 60
 const framesFolderPath = "_frames"
 const outputFolderPath = "output"
@@ -0,0 +1,102 @@
+package videogenerator
+
+import "strings"
+
+// Theme is the look of a video. Colors are picked for the notes per track,
+// channel or instrument as set by Config.ColorNotesBy; Panel and Pad color
+// the pedal lane and drum strip and their unlit bars and pads, Text the title
+// card.
+type Theme struct {
+	Name        string
+	Description string
+
+	Background Color
+	Axis       Color
+	WhiteKey   Color
+	BlackKey   Color
+	Panel      Color
+	Pad        Color
+	Text       Color
+
+	Colors               []Color
+	PedalColor           Color
+	LyricsHighlightColor Color
+	DrumPadColor         Color
+}
+
+var themeDark = Theme{
+	Name:        "dark",
+	Description: "light notes falling on a dark grey background",
+	Background:  Color{0.17, 0.17, 0.17},
+	Axis:        Color{1, 1, 1},
+	WhiteKey:    Color{1, 1, 1},
+	BlackKey:    Color{0.13, 0.13, 0.13},
+	Panel:       Color{0.1, 0.1, 0.1},
+	Pad:         Color{0.22, 0.22, 0.22},
+	Text:        Color{1, 1, 1},
+
+	Colors:               []Color{colorOrange, colorGreen, colorBlue, colorGrey, colorGrey},
+	PedalColor:           colorTeal,
+	LyricsHighlightColor: colorYellow,
+	DrumPadColor:         colorPink,
+}
+
+var themeLight = Theme{
+	Name:        "light",
+	Description: "deep colored notes on an off-white background",
+	Background:  Color{0.93, 0.93, 0.9},
+	Axis:        Color{0, 0, 0},
+	WhiteKey:    Color{1, 1, 1},
+	BlackKey:    Color{0.13, 0.13, 0.13},
+	Panel:       Color{0.25, 0.25, 0.25},
+	Pad:         Color{0.4, 0.4, 0.4},
+	Text:        Color{0.1, 0.1, 0.1},
+
+	Colors:               []Color{{0.9, 0.4, 0.05}, {0.15, 0.6, 0.3}, {0.2, 0.45, 0.85}, {0.45, 0.45, 0.45}},
+	PedalColor:           Color{0.1, 0.55, 0.5},
+	LyricsHighlightColor: Color{1, 0.75, 0.1},
+	DrumPadColor:         Color{0.85, 0.3, 0.45},
+}
+
+var themeNeon = Theme{
+	Name:        "neon",
+	Description: "bright notes on a midnight blue background",
+	Background:  Color{0.05, 0.05, 0.1},
+	Axis:        Color{0.5, 0.3, 1},
+	WhiteKey:    Color{0.95, 0.95, 1},
+	BlackKey:    Color{0.1, 0.1, 0.15},
+	Panel:       Color{0.03, 0.03, 0.07},
+	Pad:         Color{0.15, 0.15, 0.25},
+	Text:        Color{0.95, 0.95, 1},
+
+	Colors:               []Color{{1, 0.2, 0.6}, {0.2, 0.9, 1}, {0.7, 0.4, 1}, {1, 0.9, 0.2}},
+	PedalColor:           Color{0.2, 0.9, 1},
+	LyricsHighlightColor: Color{1, 0.2, 0.6},
+	DrumPadColor:         Color{0.7, 0.4, 1},
+}
+
+var themes = []Theme{themeDark, themeLight, themeNeon}
+
+// Themes returns the built-in themes, the default one first.
+func Themes() []Theme {
+	var list = make([]Theme, len(themes))
+	for i, theme := range themes {
+		list[i] = theme.clone()
+	}
+	return list
+}
+
+// ThemeByName looks up a built-in theme regardless of case.
+func ThemeByName(name string) (Theme, bool) {
+	for _, theme := range themes {
+		if strings.EqualFold(theme.Name, name) {
+			return theme.clone(), true
+		}
+	}
+	return Theme{}, false
+}
+
+func (t Theme) clone() Theme {
+	t.Colors = append([]Color{}, t.Colors...)
+	return t
+}
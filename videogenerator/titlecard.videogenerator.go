@@ -0,0 +1,58 @@
+package videogenerator
+
+import "github.com/fogleman/gg"
+
+// titleCardFadeSec is how long the title card takes to fade out at most.
+const titleCardFadeSec float64 = 0.5
+
+func (s *song) getTitleCardTitle() string {
+	if s.config.TitleCard.Title != "" {
+		return s.config.TitleCard.Title
+	}
+	return s.midi.Title()
+}
+
+// getTitleCardAlpha returns how visible the title card is at time t, fading
+// out over its last moments.
+func (r *Renderer) getTitleCardAlpha(t float64) float64 {
+	var duration = r.config.TitleCard.Duration
+	if t >= duration {
+		return 0
+	}
+	var fade = min(titleCardFadeSec, duration/4)
+	if t > duration-fade {
+		return (duration - t) / fade
+	}
+	return 1
+}
+
+func (r *Renderer) drawTitleCardLine(dc *gg.Context, text string, y, fontSize, alpha float64) {
+	dc.SetFontFace(getFontFace(fontSize))
+	var lineW, _ = dc.MeasureString(text)
+	if lineW > r.w*0.9 {
+		dc.SetFontFace(getFontFace(fontSize * r.w * 0.9 / lineW))
+	}
+	var c = r.config.Theme.Text
+	dc.SetRGBA(c.R, c.G, c.B, alpha)
+	dc.DrawStringAnchored(text, r.w/2, y, 0.5, 0.5)
+}
+
+func (s *song) drawTitleCard(dc *gg.Context, t float64) {
+	var alpha = s.getTitleCardAlpha(t)
+	var title = s.getTitleCardTitle()
+	if alpha <= 0 || (title == "" && s.config.TitleCard.Subtitle == "") {
+		return
+	}
+
+	var bg = s.config.Theme.Background
+	dc.SetRGBA(bg.R, bg.G, bg.B, alpha*0.85)
+	dc.DrawRectangle(0, 0, s.w, s.h)
+	dc.Fill()
+
+	if title != "" {
+		s.drawTitleCardLine(dc, title, s.h*0.4, s.h*0.07, alpha)
+	}
+	if s.config.TitleCard.Subtitle != "" {
+		s.drawTitleCardLine(dc, s.config.TitleCard.Subtitle, s.h*0.52, s.h*0.035, alpha*0.7)
+	}
+}
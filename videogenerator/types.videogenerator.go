@@ -1,44 +1,64 @@
 package videogenerator
 
-type Track struct {
-	Events []Event
-	Time   int
+type FallingNote struct {
+	Note       int
+	Y          float64
+	Height     float64
+	ColorIndex int
+	Velocity   int
+	// TailY and TailHeight place the faded tail of a note kept ringing by
+	// the sustain pedal after its key was released.
+	TailY      float64
+	TailHeight float64
 }
 
-type Channel struct {
-	Name       string `json:"name"`
-	Instrument string `json:"instrument"`
-	Patch      byte   `json:"patch"`
+// Pedals holds the position of each pedal controller, 0 to 127.
+type Pedals map[byte]byte
+
+type LyricSyllable struct {
+	Text string
+	Time float64
 }
 
-type Meta struct {
-	Bpm int `json:"bpm"`
+type LyricLine struct {
+	Syllables []LyricSyllable
 }
 
-type Event struct {
-	Note    int  `json:"note"`
-	OnTick  int  `json:"on_tick"`
-	Offtick int  `json:"off_tick"`
-	Channel byte `json:"channel"`
-	Meta    Meta `json:"meta"`
+func (l LyricLine) Text() string {
+	var text = ""
+	for _, syllable := range l.Syllables {
+		text += syllable.Text
+	}
+	return text
 }
 
-type HeaderMeta struct {
-	QuarterValue int `json:"quarterValue"`
+// Chapter is a section of the video in seconds, named after a MIDI marker.
+type Chapter struct {
+	Title string
+	Start float64
+	End   float64
 }
 
-type FallingNote struct {
-	Note   int
-	Y      float64
-	Height float64
-	Track  int
+type DrumHit struct {
+	Time     float64
+	Velocity int
 }
 
 type PlayingNote struct {
-	Active bool
-	Track  int
+	Active     bool
+	ColorIndex int
+	Velocity   int
 }
 
+// ColorMode decides what picks the color of a note.
+type ColorMode int
+
+const (
+	ColorByTrack ColorMode = iota
+	ColorByChannel
+	ColorByInstrument
+)
+
 type Color struct {
 	R float64
 	G float64
@@ -46,3 +66,23 @@ type Color struct {
 }
 
 type ScreenResolution [2]float64
+
+// TitleCard shows Title, or the song's title when empty, and Subtitle over
+// the first Duration seconds of the video. A Duration of 0 hides it.
+type TitleCard struct {
+	Title    string
+	Subtitle string
+	Duration float64
+}
+
+// Encoding holds the ffmpeg output settings. Empty values and a CRF of 0
+// leave ffmpeg's defaults.
+type Encoding struct {
+	VideoCodec   string
+	Preset       string
+	Tune         string
+	PixelFormat  string
+	CRF          int
+	AudioCodec   string
+	AudioBitrate string
+}